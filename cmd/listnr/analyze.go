@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sammwyy/listnr/internal/audio"
+	"github.com/sammwyy/listnr/internal/config"
+	"github.com/sammwyy/listnr/internal/library"
+)
+
+// analyze measures the loudness of the library's songs and stores the
+// results in the library index
+func analyze(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	force := flags.Bool("force", false, "re-analyze songs that already have ReplayGain tags or a measurement")
+	flags.Parse(args)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	lib := library.NewLibrary()
+	if err := lib.Scan(cfg.MusicRoutes); err != nil {
+		log.Fatal("Failed to scan music directories:", err)
+	}
+
+	err := lib.AnalyzeLoudness(ctx, audio.MeasureLoudness, *force, func(song *library.Song, done, total int, err error) {
+		if err != nil {
+			fmt.Printf("[%d/%d] %s: %v\n", done, total, song.Path, err)
+			return
+		}
+		l := song.Loudness()
+		fmt.Printf("[%d/%d] %s: %.1f LUFS, LRA %.1f LU, %.1f dBTP\n",
+			done, total, song.Path, l.Integrated, l.Range, l.TruePeak)
+	})
+	if err != nil {
+		log.Fatal("Analysis stopped:", err)
+	}
+}
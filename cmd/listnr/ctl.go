@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sammwyy/listnr/internal/ipc"
+	"github.com/sammwyy/listnr/internal/timefmt"
+)
+
+const ctlUsage = `Usage: listnr ctl [--json] <command> [arguments]
+
+Commands:
+  status                 show the playing song and player state
+  play, pause, toggle    resume, pause or toggle playback
+  stop                   stop playback
+  next, prev             skip to the next or previous song in the queue
+  seek <position>        seek to a position (90, 1:30, 1:02:03) or by
+                         seconds relative to it (+10, -10)
+  volume [level]         show or set the volume in percent (50, +5, -5)
+  mute                   toggle mute
+  queue                  list the queue
+  enqueue [--next] <file>...
+                         add library songs to the queue, or after the
+                         current song with --next
+  jump <n>               play queue entry n, counting from 1
+  clear                  clear the queue
+`
+
+// ctl sends a command to the running player over its control socket
+func ctl(args []string) {
+	flags := flag.NewFlagSet("ctl", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print replies as JSON")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, ctlUsage) }
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	client, err := ipc.Dial(ipc.SocketPath())
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		fatalf("listnr doesn't seem to be running")
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer client.Close()
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	reply, err := runCommand(client, command, args)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if reply == nil {
+		return
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(reply, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printReply(reply)
+}
+
+// runCommand calls the method for command, returning the reply worth
+// printing, if any
+func runCommand(client *rpc.Client, command string, args []string) (interface{}, error) {
+	call := func(method string, args interface{}, reply interface{}) error {
+		return client.Call(ipc.ServiceName+"."+method, args, reply)
+	}
+	empty := ipc.Empty{}
+
+	switch command {
+	case "status":
+		var status ipc.Status
+		return &status, call("Status", empty, &status)
+	case "play", "pause", "toggle", "stop", "next", "mute", "clear":
+		method := strings.ToUpper(command[:1]) + command[1:]
+		return nil, call(method, empty, &ipc.Empty{})
+	case "prev", "previous":
+		return nil, call("Previous", empty, &ipc.Empty{})
+	case "seek":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("seek needs a position")
+		}
+		seek, ok := parseSeek(args[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid position %q", args[0])
+		}
+		return nil, call("Seek", seek, &ipc.Empty{})
+	case "volume":
+		if len(args) == 0 {
+			var status ipc.Status
+			if err := call("Status", empty, &status); err != nil {
+				return nil, err
+			}
+			return volumeReply{Volume: status.Volume, Muted: status.Muted}, nil
+		}
+		volume, err := parseVolume(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return nil, call("Volume", volume, &ipc.Empty{})
+	case "queue":
+		var queue ipc.QueueReply
+		return &queue, call("Queue", empty, &queue)
+	case "enqueue":
+		enqueue := ipc.EnqueueArgs{}
+		for _, arg := range args {
+			if arg == "--next" {
+				enqueue.Next = true
+				continue
+			}
+			path, err := filepath.Abs(arg)
+			if err != nil {
+				return nil, err
+			}
+			enqueue.Paths = append(enqueue.Paths, path)
+		}
+		if len(enqueue.Paths) == 0 {
+			return nil, fmt.Errorf("enqueue needs at least one file")
+		}
+		var added int
+		return nil, call("Enqueue", enqueue, &added)
+	case "jump":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("jump needs a queue entry")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue entry %q", args[0])
+		}
+		return nil, call("Jump", n-1, &ipc.Empty{})
+	}
+	return nil, fmt.Errorf("unknown command %q, see listnr ctl --help", command)
+}
+
+type volumeReply struct {
+	Volume float64 `json:"volume"`
+	Muted  bool    `json:"muted"`
+}
+
+// parseSeek reads an absolute position, or seconds relative to the current
+// one when signed
+func parseSeek(text string) (ipc.SeekArgs, bool) {
+	if strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-") {
+		seconds, err := strconv.ParseFloat(text, 64)
+		return ipc.SeekArgs{Position: seconds, Relative: true}, err == nil
+	}
+	position, ok := timefmt.ParsePosition(text)
+	return ipc.SeekArgs{Position: position.Seconds()}, ok
+}
+
+// parseVolume reads a percentage, relative when signed
+func parseVolume(text string) (ipc.VolumeArgs, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+	if err != nil {
+		return ipc.VolumeArgs{}, fmt.Errorf("invalid volume %q", text)
+	}
+	relative := strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-")
+	return ipc.VolumeArgs{Level: percent / 100, Relative: relative}, nil
+}
+
+func printReply(reply interface{}) {
+	switch reply := reply.(type) {
+	case *ipc.Status:
+		if reply.Song == nil {
+			fmt.Println("stopped")
+		} else {
+			title := reply.Song.Title
+			if reply.Song.Artist != "" {
+				title = reply.Song.Artist + " - " + title
+			}
+			fmt.Printf("%s: %s\n", reply.State, title)
+			fmt.Printf("%s / %s\n", formatSeconds(reply.Position), formatSeconds(reply.Duration))
+		}
+		fmt.Printf("volume %s", formatVolume(reply.Volume, reply.Muted))
+		if reply.Rate != 1 {
+			fmt.Printf(", rate %.2gx", reply.Rate)
+		}
+		if reply.QueueIndex >= 0 {
+			fmt.Printf(", queue %d/%d", reply.QueueIndex+1, reply.QueueLength)
+		}
+		fmt.Println()
+	case volumeReply:
+		fmt.Println(formatVolume(reply.Volume, reply.Muted))
+	case *ipc.QueueReply:
+		for i, song := range reply.Songs {
+			marker := " "
+			if i == reply.Current {
+				marker = ">"
+			}
+			fmt.Printf("%s %3d  %s\n", marker, i+1, song.Title)
+		}
+	}
+}
+
+func formatVolume(volume float64, muted bool) string {
+	text := fmt.Sprintf("%.0f%%", volume*100)
+	if muted {
+		text += " (muted)"
+	}
+	return text
+}
+
+func formatSeconds(seconds float64) string {
+	return timefmt.Format(time.Duration(seconds) * time.Second)
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "listnr ctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -2,32 +2,68 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/sammwyy/listnr/internal/audio"
 	"github.com/sammwyy/listnr/internal/config"
+	"github.com/sammwyy/listnr/internal/ipc"
 	"github.com/sammwyy/listnr/internal/library"
+	"github.com/sammwyy/listnr/internal/mpris"
 	"github.com/sammwyy/listnr/internal/ui"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/gopxl/beep"
-	"github.com/gopxl/beep/speaker"
 )
 
 func main() {
-	// Initialize speaker for audio playback
-	sampleRate := beep.SampleRate(44100)
-	speaker.Init(sampleRate, sampleRate.N(time.Second/10))
-
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal("Failed to load config:", err)
 	}
 
+	// Output flags override the configuration
+	output := flag.String("output", cfg.Output, "audio output: system, wav or null")
+	device := flag.String("device", cfg.OutputDevice, "ALSA device of the system output, from listnr devices; empty for the default")
+	outputPath := flag.String("output-file", cfg.OutputPath, "file written by the wav output")
+	sampleRate := flag.Int("sample-rate", cfg.SampleRate, "output sample rate in Hz")
+	bufferMillis := flag.Int("buffer", cfg.BufferMillis, "output buffer size in milliseconds")
+	flag.BoolVar(&cfg.NativeSampleRate, "native-rate", cfg.NativeSampleRate, "play songs at their own sample rate where the output allows it")
+	flag.StringVar(&cfg.Resampler, "resampler", cfg.Resampler, "resampler used when sample rates differ: sinc or fast")
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "analyze":
+		analyze(cfg, flag.Args()[1:])
+		return
+	case "ctl":
+		ctl(flag.Args()[1:])
+		return
+	case "devices":
+		devices()
+		return
+	}
+
+	// Open the audio output
+	sink, err := audio.OpenSink(audio.SinkOptions{
+		Type:       *output,
+		Device:     *device,
+		Path:       *outputPath,
+		SampleRate: beep.SampleRate(*sampleRate),
+		BufferSize: time.Duration(*bufferMillis) * time.Millisecond,
+		Deferred:   cfg.NativeSampleRate,
+	})
+	if err != nil {
+		log.Fatal("Failed to open audio output:", err)
+	}
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -42,7 +78,7 @@ func main() {
 	}()
 
 	// Initialize components
-	player := audio.NewPlayer(sampleRate)
+	player := audio.NewPlayer(sink, cfg)
 	lib := library.NewLibrary()
 
 	// Scan music directories
@@ -52,7 +88,52 @@ func main() {
 
 	// Create and start UI
 	app := ui.NewApp(cfg, player, lib)
-	if err := app.Start(ctx); err != nil {
+
+	// Let scripts and media keys control the player. Without the socket, e.g.
+	// when another listnr holds it, only the TUI can.
+	server, err := ipc.Listen(ipc.SocketPath(), ipc.NewService(player, app, lib))
+	if err == nil {
+		go server.Serve()
+	} else if err != ipc.ErrAlreadyRunning {
+		log.Println("Remote control disabled:", err)
+	}
+
+	// Desktop media controls, where there is a session bus
+	bus, err := dbus.ConnectSessionBus()
+	if err == nil {
+		if media, err := mpris.New(bus, player, app, lib); err == nil {
+			go media.Run(ctx)
+		}
+	}
+
+	err = app.Start(ctx)
+
+	if bus != nil {
+		bus.Close()
+	}
+
+	if server != nil {
+		server.Close()
+	}
+
+	// Keep play counts for weighted shuffle
+	lib.Save()
+	// Finishes the file of the wav output
+	sink.Close()
+
+	if err != nil {
 		log.Fatal("Application error:", err)
 	}
 }
+
+// devices lists what --device accepts
+func devices() {
+	list, err := audio.Devices()
+	if err != nil {
+		log.Fatal("Failed to list audio devices:", err)
+	}
+	for _, device := range list {
+		// Descriptions may span lines, e.g. card and then device name
+		fmt.Printf("%s\n    %s\n", device.Name, strings.ReplaceAll(device.Description, "\n", ", "))
+	}
+}
@@ -1,11 +1,14 @@
 module github.com/sammwyy/listnr
 
-go 1.24.5
+go 1.25.6
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gdamore/tcell/v2 v2.9.0
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/gopxl/beep v1.4.1
 	github.com/rivo/tview v0.42.0
+	github.com/skrashevich/go-aac v0.1.0
 )
 
 require (
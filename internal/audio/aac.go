@@ -0,0 +1,291 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gopxl/beep"
+	"github.com/skrashevich/go-aac/pkg/decoder"
+)
+
+const aacFrameLength = 1024
+
+// aacObjectTypes names the audio object types other than AAC-LC that turn
+// up in M4A files
+var aacObjectTypes = map[uint32]string{
+	1:  "AAC Main",
+	3:  "AAC SSR",
+	4:  "AAC LTP",
+	5:  "HE-AAC (SBR)",
+	23: "AAC-LD",
+	29: "HE-AAC v2 (PS)",
+	39: "AAC-ELD",
+}
+
+// checkAACProfile rejects AudioSpecificConfigs (ISO/IEC 14496-3 1.6.2.1)
+// of anything but AAC-LC with 1024-sample frames, which would otherwise
+// fail partway through or play at the wrong length
+func checkAACProfile(asc []byte) error {
+	r := &bitReader{data: asc}
+	objectType := r.read(5)
+	if objectType == 31 {
+		objectType = 32 + r.read(6)
+	}
+	if r.read(4) == 15 { // sampling frequency given explicitly
+		r.read(24)
+	}
+	channels := r.read(4)
+	frameLength960 := r.read(1) == 1
+	if r.err != nil {
+		return errors.New("m4a: truncated AudioSpecificConfig")
+	}
+
+	if objectType != 2 {
+		name, ok := aacObjectTypes[objectType]
+		if !ok {
+			name = fmt.Sprintf("audio object type %d", objectType)
+		}
+		return fmt.Errorf("%w: m4a %s, only AAC-LC is supported", ErrUnsupportedFormat, name)
+	}
+	if frameLength960 {
+		return fmt.Errorf("%w: m4a AAC-LC with 960-sample frames", ErrUnsupportedFormat)
+	}
+
+	// SBR can also be signaled after the LC config, in a sync extension.
+	// A program config element (no channel configuration) is not skipped
+	// over, so the extension isn't looked for after one.
+	if channels == 0 {
+		return nil
+	}
+	if r.read(1) == 1 { // depends on core coder
+		r.read(14)
+	}
+	r.read(1) // extension flag, always 0 for AAC-LC
+	if r.read(11) == 0x2b7 && r.read(5) == 5 && r.read(1) == 1 && r.err == nil {
+		return fmt.Errorf("%w: m4a HE-AAC (SBR), only AAC-LC is supported", ErrUnsupportedFormat)
+	}
+	return nil
+}
+
+// bitReader reads big-endian bit fields, setting err once data runs out
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+func (r *bitReader) read(bits int) uint32 {
+	if r.pos+bits > len(r.data)*8 {
+		r.err = errors.New("out of data")
+		r.pos = len(r.data) * 8
+		return 0
+	}
+	var value uint32
+	for i := 0; i < bits; i++ {
+		bit := r.data[(r.pos+i)/8] >> (7 - uint((r.pos+i)%8)) & 1
+		value = value<<1 | uint32(bit)
+	}
+	r.pos += bits
+	return value
+}
+
+// aacStreamer decodes the AAC-LC track of an MP4/M4A file frame by frame
+type aacStreamer struct {
+	file    *os.File
+	track   *mp4Track
+	decoder *decoder.Decoder
+
+	// Decoded but not yet streamed samples of the current frame
+	buf    [][2]float64
+	bufPos int
+
+	frame    int // next frame to decode
+	position int // in samples, relative to the playable start
+	delay    int // encoder delay in samples
+	length   int // playable samples
+	err      error
+}
+
+func decodeM4A(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	track, err := parseMP4(file, info.Size())
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	if err := checkAACProfile(track.config); err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	dec := decoder.New()
+	if err := dec.SetASC(track.config); err != nil {
+		return nil, beep.Format{}, fmt.Errorf("m4a: %w", err)
+	}
+
+	sampleRate := dec.Config.SampleRate
+	if sampleRate <= 0 {
+		return nil, beep.Format{}, errors.New("m4a: invalid sample rate")
+	}
+
+	// Convert media timescale units into samples
+	toSamples := func(units int64) int {
+		if track.timescale == 0 || int(track.timescale) == sampleRate {
+			return int(units)
+		}
+		return int(units * int64(sampleRate) / int64(track.timescale))
+	}
+
+	s := &aacStreamer{
+		file:    file,
+		track:   track,
+		decoder: dec,
+		delay:   toSamples(track.mediaStart),
+	}
+
+	total := len(track.offsets) * aacFrameLength
+	if decoded := toSamples(track.totalSamples()); decoded > 0 && decoded < total {
+		total = decoded
+	}
+	s.length = total - s.delay
+	if track.mediaLength >= 0 {
+		if playable := toSamples(track.mediaLength); playable < s.length {
+			s.length = playable
+		}
+	}
+	if s.length < 0 {
+		s.length = 0
+	}
+
+	if err := s.Seek(0); err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	format := beep.Format{
+		SampleRate:  beep.SampleRate(sampleRate),
+		NumChannels: 2,
+		Precision:   2,
+	}
+	return s, format, nil
+}
+
+func (s *aacStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.err != nil {
+		return 0, false
+	}
+
+	for n < len(samples) && s.position < s.length {
+		if s.bufPos >= len(s.buf) {
+			if err := s.decodeNext(); err != nil {
+				s.err = err
+				break
+			}
+			if len(s.buf) == 0 {
+				break
+			}
+		}
+
+		count := copy(samples[n:], s.buf[s.bufPos:])
+		if remaining := s.length - s.position; count > remaining {
+			count = remaining
+		}
+		s.bufPos += count
+		s.position += count
+		n += count
+	}
+
+	return n, n > 0
+}
+
+// decodeNext decodes the next frame into buf. An empty buf means end of stream.
+func (s *aacStreamer) decodeNext() error {
+	s.buf = s.buf[:0]
+	s.bufPos = 0
+
+	if s.frame >= len(s.track.offsets) {
+		return nil
+	}
+
+	pcm, err := s.decodeFrame(s.frame)
+	s.frame++
+	if err != nil {
+		return err
+	}
+
+	channels := len(s.decoder.Data)
+	if channels == 0 {
+		return errors.New("m4a: frame without channels")
+	}
+
+	for i := 0; i+channels <= len(pcm); i += channels {
+		left := float64(pcm[i])
+		right := left
+		if channels > 1 {
+			right = float64(pcm[i+1])
+		}
+		s.buf = append(s.buf, [2]float64{left, right})
+	}
+
+	return nil
+}
+
+func (s *aacStreamer) decodeFrame(index int) ([]float32, error) {
+	data := make([]byte, s.track.sizes[index])
+	if _, err := s.file.ReadAt(data, s.track.offsets[index]); err != nil {
+		return nil, err
+	}
+	return s.decoder.DecodeFrame(data)
+}
+
+func (s *aacStreamer) Err() error {
+	return s.err
+}
+
+func (s *aacStreamer) Len() int {
+	return s.length
+}
+
+func (s *aacStreamer) Position() int {
+	return s.position
+}
+
+func (s *aacStreamer) Seek(p int) error {
+	if p < 0 || p > s.length {
+		return fmt.Errorf("m4a: seek position %d out of range [0, %d]", p, s.length)
+	}
+
+	target := p + s.delay
+	frame := target / aacFrameLength
+
+	// The filterbank overlaps consecutive frames, so prime it with the previous
+	// one, or start from a clean state at the beginning of the stream
+	if frame == 0 {
+		if err := s.decoder.SetASC(s.track.config); err != nil {
+			return err
+		}
+	} else if frame <= len(s.track.offsets) {
+		if _, err := s.decodeFrame(frame - 1); err != nil {
+			return err
+		}
+	}
+
+	s.frame = frame
+	s.err = nil
+	if err := s.decodeNext(); err != nil {
+		return err
+	}
+
+	s.bufPos = target - frame*aacFrameLength
+	if s.bufPos > len(s.buf) {
+		s.bufPos = len(s.buf)
+	}
+	s.position = p
+	return nil
+}
+
+func (s *aacStreamer) Close() error {
+	return s.file.Close()
+}
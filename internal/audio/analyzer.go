@@ -9,25 +9,81 @@ import (
 	"github.com/gopxl/beep"
 )
 
+const (
+	DefaultBandCount = 16
+
+	fftSize      = 2048
+	fftHopSize   = fftSize / 2 // 50% overlap between frames
+	minBandFreq  = 40.0
+	maxBandFreq  = 16000.0
+	minBandLevel = -60.0 // dB mapped to an empty bar
+	bandTiltDB   = 3.0   // dB per octave, compensates the natural high-frequency roll-off of music
+)
+
 type AudioAnalyzer struct {
 	beep.Streamer
-	samples      []float64
-	sampleBuffer [][]float64
-	bufferSize   int
-	bufferPos    int
-	eventBus     *events.EventBus
-	lastUpdate   time.Time
+	eventBus   *events.EventBus
+	lastUpdate time.Time
+
+	// FFT state
+	sampleRate beep.SampleRate
+	window     []float64
+	windowSum  float64
+	ring       []float64
+	ringPos    int
+	pending    int
+	spectrum   []complex128
+	bandEdges  []float64
+	bandTilt   []float64
+
+	// Accumulated between published updates
+	bandSum     []float64
+	frames      int
+	amplitude   float64
+	sampleCount int
 }
 
-func NewAudioAnalyzer(streamer beep.Streamer, eventBus *events.EventBus) *AudioAnalyzer {
-	return &AudioAnalyzer{
-		Streamer:     streamer,
-		samples:      make([]float64, 1024),
-		sampleBuffer: make([][]float64, 2), // Stereo
-		bufferSize:   512,
-		bufferPos:    0,
-		eventBus:     eventBus,
-		lastUpdate:   time.Now(),
+func NewAudioAnalyzer(streamer beep.Streamer, eventBus *events.EventBus, sampleRate beep.SampleRate, bands int) *AudioAnalyzer {
+	if bands <= 0 {
+		bands = DefaultBandCount
+	}
+
+	window := hannWindow(fftSize)
+	var windowSum float64
+	for _, w := range window {
+		windowSum += w
+	}
+
+	a := &AudioAnalyzer{
+		Streamer:   streamer,
+		eventBus:   eventBus,
+		lastUpdate: time.Now(),
+		sampleRate: sampleRate,
+		window:     window,
+		windowSum:  windowSum,
+		ring:       make([]float64, fftSize),
+		spectrum:   make([]complex128, fftSize),
+		bandSum:    make([]float64, bands),
+	}
+	a.computeBands(bands)
+
+	return a
+}
+
+// computeBands splits the audible range into log-spaced bands
+func (a *AudioAnalyzer) computeBands(bands int) {
+	nyquist := float64(a.sampleRate) / 2
+	high := math.Min(maxBandFreq, nyquist)
+
+	a.bandEdges = make([]float64, bands+1)
+	for i := range a.bandEdges {
+		a.bandEdges[i] = minBandFreq * math.Pow(high/minBandFreq, float64(i)/float64(bands))
+	}
+
+	a.bandTilt = make([]float64, bands)
+	for i := range a.bandTilt {
+		center := math.Sqrt(a.bandEdges[i] * a.bandEdges[i+1])
+		a.bandTilt[i] = bandTiltDB * math.Log2(center/1000)
 	}
 }
 
@@ -42,27 +98,38 @@ func (a *AudioAnalyzer) Stream(samples [][2]float64) (n int, ok bool) {
 }
 
 func (a *AudioAnalyzer) analyzeSamples(samples [][2]float64) {
+	for _, sample := range samples {
+		left := math.Abs(sample[0])
+		right := math.Abs(sample[1])
+		a.amplitude += (left + right) / 2
+		a.sampleCount++
+
+		a.ring[a.ringPos] = (sample[0] + sample[1]) / 2
+		a.ringPos = (a.ringPos + 1) % fftSize
+		a.pending++
+		if a.pending >= fftHopSize {
+			a.pending = 0
+			a.accumulateSpectrum()
+		}
+	}
+
 	// Throttle updates
 	now := time.Now()
-	if now.Sub(a.lastUpdate) < 50*time.Millisecond {
+	if now.Sub(a.lastUpdate) < 50*time.Millisecond || a.frames == 0 {
 		return
 	}
 	a.lastUpdate = now
 
-	var totalAmplitude float64
-	for _, sample := range samples {
-		left := math.Abs(sample[0])
-		right := math.Abs(sample[1])
-		amplitude := (left + right) / 2
-		totalAmplitude += amplitude
+	frequencyBands := make([]float64, len(a.bandSum))
+	for i, sum := range a.bandSum {
+		frequencyBands[i] = sum / float64(a.frames)
+		a.bandSum[i] = 0
 	}
+	a.frames = 0
 
-	if len(samples) > 0 {
-		totalAmplitude /= float64(len(samples))
-	}
-
-	// Simulate brand freq (To-Do: switch to a FFT system)
-	frequencyBands := a.simulateFrequencyBands(samples, totalAmplitude)
+	totalAmplitude := a.amplitude / float64(a.sampleCount)
+	a.amplitude = 0
+	a.sampleCount = 0
 
 	// Publish event
 	a.eventBus.Publish(events.Event{
@@ -75,52 +142,46 @@ func (a *AudioAnalyzer) analyzeSamples(samples [][2]float64) {
 	})
 }
 
-func (a *AudioAnalyzer) simulateFrequencyBands(samples [][2]float64, baseAmplitude float64) []float64 {
-	bands := make([]float64, 16)
-
-	if len(samples) == 0 {
-		return bands
+// accumulateSpectrum runs a windowed FFT over the latest frame and adds its
+// band levels to the running average (Welch's method over overlapping frames)
+func (a *AudioAnalyzer) accumulateSpectrum() {
+	for i := 0; i < fftSize; i++ {
+		sample := a.ring[(a.ringPos+i)%fftSize]
+		a.spectrum[i] = complex(sample*a.window[i], 0)
 	}
+	fft(a.spectrum)
 
-	samplesPerBand := len(samples) / 16
-	if samplesPerBand < 1 {
-		samplesPerBand = 1
-	}
+	binWidth := float64(a.sampleRate) / fftSize
+	scale := 2 / a.windowSum
 
-	for i := 0; i < 16; i++ {
-		var bandAmplitude float64
-		start := i * samplesPerBand
-		end := start + samplesPerBand
-
-		if end > len(samples) {
-			end = len(samples)
-		}
-
-		for j := start; j < end; j++ {
-			left := math.Abs(samples[j][0])
-			right := math.Abs(samples[j][1])
-			bandAmplitude += (left + right) / 2
+	for band := range a.bandSum {
+		lo := int(a.bandEdges[band] / binWidth)
+		hi := int(math.Ceil(a.bandEdges[band+1] / binWidth))
+		if hi <= lo {
+			hi = lo + 1
 		}
-
-		if end > start {
-			bandAmplitude /= float64(end - start)
+		if hi > fftSize/2 {
+			hi = fftSize / 2
 		}
 
-		freqRatio := float64(i) / 15.0
-
-		if freqRatio < 0.3 {
-			bandAmplitude *= 1.2 - (freqRatio * 0.5)
-		} else if freqRatio < 0.7 {
-			bandAmplitude *= 1.0
-		} else {
-			bandAmplitude *= 0.8 - (freqRatio * 0.3)
+		var peak float64
+		for bin := lo; bin < hi; bin++ {
+			re, im := real(a.spectrum[bin]), imag(a.spectrum[bin])
+			magnitude := math.Sqrt(re*re+im*im) * scale
+			if magnitude > peak {
+				peak = magnitude
+			}
 		}
 
-		bands[i] = math.Min(bandAmplitude*3, 1.0)
-		if bands[i] < 0 {
-			bands[i] = 0
-		}
+		a.bandSum[band] += levelFromMagnitude(peak, a.bandTilt[band])
 	}
+	a.frames++
+}
 
-	return bands
+func levelFromMagnitude(magnitude, tilt float64) float64 {
+	if magnitude <= 0 {
+		return 0
+	}
+	db := 20*math.Log10(magnitude) + tilt
+	return clamp((db-minBandLevel)/-minBandLevel, 0.0, 1.0)
 }
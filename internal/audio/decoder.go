@@ -1,6 +1,8 @@
 package audio
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,6 +14,9 @@ import (
 	"github.com/gopxl/beep/wav"
 )
 
+// ErrUnsupportedFormat is returned by DecodeFile for files of unknown type
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
 func DecodeFile(path string) (beep.StreamSeekCloser, beep.Format, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -31,9 +36,11 @@ func DecodeFile(path string) (beep.StreamSeekCloser, beep.Format, error) {
 		streamer, format, err = flac.Decode(file)
 	case ".ogg":
 		streamer, format, err = vorbis.Decode(file)
+	case ".m4a":
+		streamer, format, err = decodeM4A(file)
 	default:
 		file.Close()
-		return nil, beep.Format{}, err
+		return nil, beep.Format{}, fmt.Errorf("%w %q", ErrUnsupportedFormat, ext)
 	}
 
 	if err != nil {
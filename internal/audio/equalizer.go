@@ -0,0 +1,114 @@
+package audio
+
+import (
+	"math"
+
+	"github.com/gopxl/beep"
+)
+
+const (
+	EqualizerMaxGain = 12.0 // dB, in either direction
+	equalizerQ       = 1.41 // one octave per band
+)
+
+// EqualizerFrequencies are the center frequencies of the graphic equalizer bands
+var EqualizerFrequencies = []float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// EqualizerPresetNames lists the built-in presets in display order
+var EqualizerPresetNames = []string{
+	"flat", "bass_boost", "treble_boost", "vocal", "rock", "pop", "jazz", "classical", "electronic",
+}
+
+// EqualizerPresets holds the band gains in dB of the built-in presets
+var EqualizerPresets = map[string][]float64{
+	"flat":         {0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	"bass_boost":   {6, 5, 4, 2, 0, 0, 0, 0, 0, 0},
+	"treble_boost": {0, 0, 0, 0, 0, 0, 2, 4, 5, 6},
+	"vocal":        {-2, -2, -1, 1, 3, 4, 3, 1, 0, -1},
+	"rock":         {5, 4, 2, -1, -2, -1, 1, 3, 4, 5},
+	"pop":          {-1, 1, 3, 4, 3, 0, -1, -1, 1, 2},
+	"jazz":         {3, 2, 1, 2, -1, -1, 0, 1, 2, 3},
+	"classical":    {4, 3, 2, 1, 0, 0, 0, 2, 3, 4},
+	"electronic":   {5, 4, 1, 0, -2, 1, 0, 1, 4, 5},
+}
+
+// Equalizer is a graphic equalizer made of one peaking filter per band
+type Equalizer struct {
+	beep.Streamer
+	sampleRate beep.SampleRate
+	gains      []float64
+	filters    [][2]biquad // per band, per channel
+	active     bool
+}
+
+func NewEqualizer(streamer beep.Streamer, sampleRate beep.SampleRate, gains []float64) *Equalizer {
+	e := &Equalizer{
+		Streamer:   streamer,
+		sampleRate: sampleRate,
+		filters:    make([][2]biquad, len(EqualizerFrequencies)),
+	}
+	e.SetGains(gains)
+	return e
+}
+
+// SetGains updates the band gains in dB. Missing bands are flat. Callers
+// streaming through a sink must hold its lock.
+func (e *Equalizer) SetGains(gains []float64) {
+	e.gains = make([]float64, len(EqualizerFrequencies))
+	copy(e.gains, gains)
+
+	e.active = false
+	nyquist := float64(e.sampleRate) / 2
+	for band, freq := range EqualizerFrequencies {
+		e.gains[band] = clamp(e.gains[band], -EqualizerMaxGain, EqualizerMaxGain)
+		if e.gains[band] != 0 && freq < nyquist {
+			e.active = true
+		}
+
+		// Keep the filter state so changes don't click
+		for c := range e.filters[band] {
+			e.filters[band][c].setPeaking(freq, e.gains[band], float64(e.sampleRate))
+		}
+	}
+}
+
+func (e *Equalizer) Gains() []float64 {
+	gains := make([]float64, len(e.gains))
+	copy(gains, e.gains)
+	return gains
+}
+
+func (e *Equalizer) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = e.Streamer.Stream(samples)
+	if !e.active {
+		return n, ok
+	}
+
+	nyquist := float64(e.sampleRate) / 2
+	for band, gain := range e.gains {
+		if gain == 0 || EqualizerFrequencies[band] >= nyquist {
+			continue
+		}
+		filters := &e.filters[band]
+		for i := range samples[:n] {
+			samples[i][0] = filters[0].process(samples[i][0])
+			samples[i][1] = filters[1].process(samples[i][1])
+		}
+	}
+	return n, ok
+}
+
+// setPeaking configures a peaking EQ filter (RBJ audio EQ cookbook)
+func (f *biquad) setPeaking(freq, gain, sampleRate float64) {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * freq / sampleRate
+	alpha := math.Sin(w0) / (2 * equalizerQ)
+	cos := math.Cos(w0)
+
+	a0 := 1 + alpha/a
+	f.b0 = (1 + alpha*a) / a0
+	f.b1 = -2 * cos / a0
+	f.b2 = (1 - alpha*a) / a0
+	f.a1 = -2 * cos / a0
+	f.a2 = (1 - alpha/a) / a0
+}
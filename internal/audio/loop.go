@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"time"
+
+	"github.com/gopxl/beep"
+)
+
+const (
+	LoopStart = "start" // set point A at the current position
+	LoopEnd   = "end"   // set point B and start looping
+	LoopClear = "clear"
+	LoopCycle = "cycle" // A, then B, then clear
+)
+
+// looper repeats the section between points A and B of the decoder it wraps,
+// seeking back to A the moment B is reached. Points are decoder samples, -1
+// when unset, and only touched under the sink lock.
+type looper struct {
+	decoder beep.StreamSeeker
+	start   int
+	end     int
+}
+
+func newLooper(decoder beep.StreamSeeker) *looper {
+	return &looper{decoder: decoder, start: -1, end: -1}
+}
+
+func (l *looper) active() bool {
+	return l.start >= 0 && l.end > l.start
+}
+
+func (l *looper) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		chunk := samples[n:]
+		if l.active() {
+			pos := l.decoder.Position()
+			if pos >= l.end {
+				if err := l.decoder.Seek(l.start); err != nil {
+					// Play on rather than spin on a decoder that can't seek
+					l.end = -1
+				}
+				continue
+			}
+			if left := l.end - pos; left < len(chunk) {
+				chunk = chunk[:left]
+			}
+		}
+
+		m, ok := l.decoder.Stream(chunk)
+		n += m
+		if !ok {
+			return n, n > 0
+		}
+		if m == 0 {
+			break
+		}
+	}
+	return n, true
+}
+
+func (l *looper) Err() error {
+	return l.decoder.Err()
+}
+
+// points returns A and B as durations, -1 when unset
+func (l *looper) points(sampleRate beep.SampleRate) (start, end time.Duration) {
+	start, end = -1, -1
+	if l.start >= 0 {
+		start = sampleRate.D(l.start)
+	}
+	if l.end >= 0 {
+		end = sampleRate.D(l.end)
+	}
+	return start, end
+}
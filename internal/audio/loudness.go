@@ -0,0 +1,270 @@
+package audio
+
+import (
+	"math"
+	"sort"
+
+	"github.com/sammwyy/listnr/internal/library"
+)
+
+// EBU R128 / ITU-R BS.1770-4 loudness measurement
+const (
+	absoluteGate       = -70.0 // LUFS
+	integratedGate     = -10.0 // LU below the ungated mean
+	rangeGate          = -20.0
+	minTruePeak        = -120.0 // dBTP reported for digital silence
+	truePeakTaps       = 12     // per oversampling phase
+	truePeakOversample = 4
+)
+
+// biquad is a direct form I second order filter
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the BS.1770 pre-filter (high shelf) and RLB high-pass
+// filter for sampleRate
+func kWeighting(sampleRate float64) (shelf, highPass biquad) {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// truePeakFilter is a windowed-sinc interpolator for 4x oversampling
+func truePeakFilter() [][]float64 {
+	length := truePeakTaps * truePeakOversample
+	center := float64(length-1) / 2
+
+	phases := make([][]float64, truePeakOversample)
+	for p := range phases {
+		phases[p] = make([]float64, truePeakTaps)
+	}
+	for n := 0; n < length; n++ {
+		x := (float64(n) - center) / truePeakOversample
+		h := 1.0
+		if x != 0 {
+			h = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		// Hann window
+		h *= 0.5 - 0.5*math.Cos(2*math.Pi*(float64(n)+0.5)/float64(length))
+		phases[n%truePeakOversample][n/truePeakOversample] = h
+	}
+	return phases
+}
+
+// loudnessMeter accumulates the energy of 100 ms sub-blocks, from which the
+// 400 ms momentary and 3 s short-term blocks are built
+type loudnessMeter struct {
+	channels  int
+	shelf     []biquad
+	highPass  []biquad
+	blockSize int
+	energy    float64
+	count     int
+	blocks    []float64
+
+	// True peak state
+	filter  [][]float64
+	history [][]float64
+	peak    float64
+}
+
+func newLoudnessMeter(sampleRate float64, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		channels:  channels,
+		blockSize: int(sampleRate / 10),
+		filter:    truePeakFilter(),
+	}
+	for c := 0; c < channels; c++ {
+		shelf, highPass := kWeighting(sampleRate)
+		m.shelf = append(m.shelf, shelf)
+		m.highPass = append(m.highPass, highPass)
+		m.history = append(m.history, make([]float64, truePeakTaps))
+	}
+	return m
+}
+
+func (m *loudnessMeter) add(samples [][2]float64) {
+	for _, sample := range samples {
+		for c := 0; c < m.channels; c++ {
+			x := sample[c]
+			y := m.highPass[c].process(m.shelf[c].process(x))
+			m.energy += y * y
+			m.updatePeak(c, x)
+		}
+
+		m.count++
+		if m.count == m.blockSize {
+			m.blocks = append(m.blocks, m.energy/float64(m.blockSize))
+			m.energy = 0
+			m.count = 0
+		}
+	}
+}
+
+func (m *loudnessMeter) updatePeak(channel int, x float64) {
+	history := m.history[channel]
+	copy(history[1:], history[:len(history)-1])
+	history[0] = x
+
+	if a := math.Abs(x); a > m.peak {
+		m.peak = a
+	}
+	for _, phase := range m.filter {
+		var y float64
+		for k, h := range phase {
+			y += history[k] * h
+		}
+		if a := math.Abs(y); a > m.peak {
+			m.peak = a
+		}
+	}
+}
+
+// windows returns the mean energy of every window of size sub-blocks, advancing by hop
+func (m *loudnessMeter) windows(size, hop int) []float64 {
+	var energies []float64
+	for start := 0; start+size <= len(m.blocks); start += hop {
+		var sum float64
+		for _, e := range m.blocks[start : start+size] {
+			sum += e
+		}
+		energies = append(energies, sum/float64(size))
+	}
+	return energies
+}
+
+func (m *loudnessMeter) result() *library.Loudness {
+	result := &library.Loudness{
+		Integrated: absoluteGate,
+		TruePeak:   minTruePeak,
+	}
+	if m.peak > 0 {
+		result.TruePeak = math.Max(20*math.Log10(m.peak), minTruePeak)
+	}
+
+	// Integrated loudness over 400 ms blocks with 75% overlap
+	if gated := gate(m.windows(4, 1), integratedGate); len(gated) > 0 {
+		result.Integrated = energyToLoudness(meanEnergy(gated))
+	}
+
+	// Loudness range over 3 s blocks, advancing by 1 s
+	if gated := gate(m.windows(30, 10), rangeGate); len(gated) > 1 {
+		levels := make([]float64, len(gated))
+		for i, e := range gated {
+			levels[i] = energyToLoudness(e)
+		}
+		sort.Float64s(levels)
+		result.Range = percentile(levels, 0.95) - percentile(levels, 0.10)
+	}
+
+	return result
+}
+
+// gate drops blocks below the absolute gate, then those more than relative
+// LU below the mean of the remaining ones
+func gate(energies []float64, relative float64) []float64 {
+	var absolute []float64
+	for _, e := range energies {
+		if energyToLoudness(e) > absoluteGate {
+			absolute = append(absolute, e)
+		}
+	}
+	if len(absolute) == 0 {
+		return nil
+	}
+
+	threshold := energyToLoudness(meanEnergy(absolute)) + relative
+	var gated []float64
+	for _, e := range absolute {
+		if energyToLoudness(e) > threshold {
+			gated = append(gated, e)
+		}
+	}
+	return gated
+}
+
+func meanEnergy(energies []float64) float64 {
+	var sum float64
+	for _, e := range energies {
+		sum += e
+	}
+	return sum / float64(len(energies))
+}
+
+func energyToLoudness(energy float64) float64 {
+	if energy <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// percentile interpolates linearly between the nearest ranks of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lower := int(pos)
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	frac := pos - float64(lower)
+	return sorted[lower]*(1-frac) + sorted[lower+1]*frac
+}
+
+// MeasureLoudness decodes the file at path and measures its integrated
+// loudness, loudness range and true peak
+func MeasureLoudness(path string) (*library.Loudness, error) {
+	streamer, format, err := DecodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer streamer.Close()
+
+	channels := format.NumChannels
+	if channels < 1 || channels > 2 {
+		channels = 2
+	}
+	meter := newLoudnessMeter(float64(format.SampleRate), channels)
+
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(buf)
+		meter.add(buf[:n])
+		if !ok || n < len(buf) {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return nil, err
+	}
+
+	return meter.result(), nil
+}
@@ -0,0 +1,472 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sammwyy/listnr/internal/mp4"
+)
+
+var errNoAudioTrack = errors.New("mp4: no AAC audio track found")
+
+// mp4Track describes the first AAC audio track of an MP4/M4A container
+type mp4Track struct {
+	timescale    uint32
+	duration     uint64 // in timescale units
+	sampleRate   int
+	channels     int
+	config       []byte // AudioSpecificConfig from the esds box
+	offsets      []int64
+	sizes        []uint32
+	mediaStart   int64 // samples to drop at the start (encoder delay, from elst)
+	mediaLength  int64 // playable samples, -1 when unknown
+	movieScale   uint32
+	sampleCounts []sttsEntry
+}
+
+type sttsEntry struct {
+	count uint32
+	delta uint32
+}
+
+func parseMP4(r io.ReaderAt, fileSize int64) (*mp4Track, error) {
+	top, err := mp4.ReadBoxes(r, 0, fileSize)
+	if err != nil && len(top) == 0 {
+		return nil, err
+	}
+
+	moov, ok := mp4.Find(top, "moov")
+	if !ok {
+		return nil, errors.New("mp4: missing moov box")
+	}
+
+	moovChildren, err := mp4.Children(r, moov)
+	if err != nil {
+		return nil, err
+	}
+
+	var movieScale uint32
+	if mvhd, ok := mp4.Find(moovChildren, "mvhd"); ok {
+		if data, err := mp4.ReadData(r, mvhd); err == nil && len(data) >= 24 {
+			if data[0] == 1 {
+				movieScale = binary.BigEndian.Uint32(data[20:24])
+			} else {
+				movieScale = binary.BigEndian.Uint32(data[12:16])
+			}
+		}
+	}
+
+	for _, trak := range moovChildren {
+		if trak.Type != "trak" {
+			continue
+		}
+
+		track, err := parseTrack(r, trak, movieScale, fileSize)
+		if err == errNoAudioTrack {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return track, nil
+	}
+
+	return nil, errNoAudioTrack
+}
+
+func parseTrack(r io.ReaderAt, trak mp4.Box, movieScale uint32, fileSize int64) (*mp4Track, error) {
+	trakChildren, err := mp4.Children(r, trak)
+	if err != nil {
+		return nil, err
+	}
+
+	mdiaChildren := func() []mp4.Box {
+		mdia, ok := mp4.Find(trakChildren, "mdia")
+		if !ok {
+			return nil
+		}
+		children, _ := mp4.Children(r, mdia)
+		return children
+	}()
+
+	hdlr, ok := mp4.Find(mdiaChildren, "hdlr")
+	if !ok {
+		return nil, errNoAudioTrack
+	}
+	hdlrData, err := mp4.ReadData(r, hdlr)
+	if err != nil || len(hdlrData) < 12 || string(hdlrData[8:12]) != "soun" {
+		return nil, errNoAudioTrack
+	}
+
+	stsd, ok := mp4.FindPath(r, mdiaChildren, "minf", "stbl", "stsd")
+	if !ok {
+		return nil, errNoAudioTrack
+	}
+
+	track := &mp4Track{mediaLength: -1, movieScale: movieScale}
+	if err := track.parseSampleDescription(r, stsd); err != nil {
+		return nil, err
+	}
+
+	if mdhd, ok := mp4.Find(mdiaChildren, "mdhd"); ok {
+		data, err := mp4.ReadData(r, mdhd)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) >= 32 && data[0] == 1 {
+			track.timescale = binary.BigEndian.Uint32(data[20:24])
+			track.duration = binary.BigEndian.Uint64(data[24:32])
+		} else if len(data) >= 20 {
+			track.timescale = binary.BigEndian.Uint32(data[12:16])
+			track.duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+		}
+	}
+
+	stbl, _ := mp4.FindPath(r, mdiaChildren, "minf", "stbl")
+	stblChildren, err := mp4.Children(r, stbl)
+	if err != nil {
+		return nil, err
+	}
+	if err := track.parseSampleTable(r, stblChildren, fileSize); err != nil {
+		return nil, err
+	}
+
+	if elst, ok := mp4.FindPath(r, trakChildren, "edts", "elst"); ok {
+		track.parseEditList(r, elst)
+	}
+
+	return track, nil
+}
+
+func (t *mp4Track) parseSampleDescription(r io.ReaderAt, stsd mp4.Box) error {
+	// Full box header + entry count
+	if stsd.Size < 8 {
+		return errors.New("mp4: truncated stsd box")
+	}
+	entries, err := mp4.ReadBoxes(r, stsd.Offset+8, stsd.Size-8)
+	if err != nil && len(entries) == 0 {
+		return err
+	}
+
+	mp4a, ok := mp4.Find(entries, "mp4a")
+	if !ok {
+		return errNoAudioTrack
+	}
+
+	data, err := mp4.ReadData(r, mp4a)
+	if err != nil {
+		return err
+	}
+	if len(data) < 28 {
+		return errors.New("mp4: truncated mp4a sample entry")
+	}
+
+	t.channels = int(binary.BigEndian.Uint16(data[16:18]))
+	t.sampleRate = int(binary.BigEndian.Uint32(data[24:28]) >> 16)
+
+	// QuickTime sound description versions carry extra fields
+	childOffset := int64(28)
+	switch binary.BigEndian.Uint16(data[8:10]) {
+	case 1:
+		childOffset += 16
+	case 2:
+		childOffset += 36
+	}
+
+	if childOffset > mp4a.Size {
+		return errors.New("mp4: truncated mp4a sample entry")
+	}
+	children, _ := mp4.ReadBoxes(r, mp4a.Offset+childOffset, mp4a.Size-childOffset)
+	esds, ok := mp4.Find(children, "esds")
+	if !ok {
+		return errors.New("mp4: missing esds box")
+	}
+
+	esdsData, err := mp4.ReadData(r, esds)
+	if err != nil {
+		return err
+	}
+
+	if len(esdsData) < 4 {
+		return errors.New("mp4: truncated esds box")
+	}
+
+	t.config, err = parseESDS(esdsData[4:])
+	return err
+}
+
+// parseESDS extracts the AudioSpecificConfig from an ES_Descriptor
+func parseESDS(data []byte) ([]byte, error) {
+	readDescriptor := func(data []byte) (tag byte, body []byte, rest []byte, err error) {
+		if len(data) < 2 {
+			return 0, nil, nil, errors.New("mp4: truncated esds descriptor")
+		}
+		tag = data[0]
+		length := 0
+		i := 1
+		for ; i < len(data) && i <= 4; i++ {
+			length = length<<7 | int(data[i]&0x7f)
+			if data[i]&0x80 == 0 {
+				i++
+				break
+			}
+		}
+		if i+length > len(data) {
+			length = len(data) - i
+		}
+		return tag, data[i : i+length], data[i+length:], nil
+	}
+
+	tag, es, _, err := readDescriptor(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0x03 || len(es) < 3 {
+		return nil, errors.New("mp4: missing ES descriptor")
+	}
+
+	// Skip the optional fields announced by the flags
+	flags := es[2]
+	es = es[3:]
+	skip := func(n int) bool {
+		if n > len(es) {
+			return false
+		}
+		es = es[n:]
+		return true
+	}
+	if flags&0x80 != 0 && !skip(2) { // streamDependenceFlag
+		return nil, errors.New("mp4: truncated ES descriptor")
+	}
+	if flags&0x40 != 0 && (len(es) == 0 || !skip(1+int(es[0]))) { // URL_Flag
+		return nil, errors.New("mp4: truncated ES descriptor")
+	}
+	if flags&0x20 != 0 && !skip(2) { // OCRstreamFlag
+		return nil, errors.New("mp4: truncated ES descriptor")
+	}
+
+	for len(es) > 0 {
+		tag, body, rest, err := readDescriptor(es)
+		if err != nil {
+			return nil, err
+		}
+		if tag == 0x04 && len(body) >= 13 {
+			if body[0] != 0x40 && body[0] != 0x67 {
+				return nil, fmt.Errorf("mp4: unsupported object type 0x%02x", body[0])
+			}
+			_, asc, _, err := readDescriptor(body[13:])
+			if err != nil {
+				return nil, err
+			}
+			return asc, nil
+		}
+		es = rest
+	}
+
+	return nil, errors.New("mp4: missing decoder specific info")
+}
+
+// parseSampleTable resolves the file offset and size of every sample. Counts
+// are checked against the box sizes and samples against the file size, so a
+// corrupt table fails instead of reading out of bounds.
+func (t *mp4Track) parseSampleTable(r io.ReaderAt, boxes []mp4.Box, fileSize int64) error {
+	stsz, ok := mp4.Find(boxes, "stsz")
+	if !ok {
+		return errors.New("mp4: missing stsz box")
+	}
+	data, err := mp4.ReadData(r, stsz)
+	if err != nil {
+		return err
+	}
+	if len(data) < 12 {
+		return errors.New("mp4: truncated stsz box")
+	}
+	uniformSize := binary.BigEndian.Uint32(data[4:8])
+	var count int
+	if uniformSize != 0 {
+		// Uniformly sized samples have no table, but must still fit in the file
+		count = int(binary.BigEndian.Uint32(data[8:12]))
+		if int64(count)*int64(uniformSize) > fileSize {
+			return errors.New("mp4: stsz sample count exceeds the file")
+		}
+	} else if count, err = tableCount(data[8:12], len(data)-12, 4, "stsz"); err != nil {
+		return err
+	}
+	t.sizes = make([]uint32, count)
+	for i := range t.sizes {
+		if uniformSize != 0 {
+			t.sizes[i] = uniformSize
+		} else {
+			t.sizes[i] = binary.BigEndian.Uint32(data[12+i*4:])
+		}
+	}
+
+	var chunkOffsets []int64
+	if stco, ok := mp4.Find(boxes, "stco"); ok {
+		data, err := mp4.ReadData(r, stco)
+		if err != nil {
+			return err
+		}
+		if len(data) < 8 {
+			return errors.New("mp4: truncated stco box")
+		}
+		n, err := tableCount(data[4:8], len(data)-8, 4, "stco")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(data[8+i*4:])))
+		}
+	} else if co64, ok := mp4.Find(boxes, "co64"); ok {
+		data, err := mp4.ReadData(r, co64)
+		if err != nil {
+			return err
+		}
+		if len(data) < 8 {
+			return errors.New("mp4: truncated co64 box")
+		}
+		n, err := tableCount(data[4:8], len(data)-8, 8, "co64")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(data[8+i*8:])))
+		}
+	} else {
+		return errors.New("mp4: missing chunk offset box")
+	}
+
+	stsc, ok := mp4.Find(boxes, "stsc")
+	if !ok {
+		return errors.New("mp4: missing stsc box")
+	}
+	stscData, err := mp4.ReadData(r, stsc)
+	if err != nil {
+		return err
+	}
+	if len(stscData) < 8 {
+		return errors.New("mp4: truncated stsc box")
+	}
+
+	type stscEntry struct{ firstChunk, samplesPerChunk int }
+	var chunkMap []stscEntry
+	n, err := tableCount(stscData[4:8], len(stscData)-8, 12, "stsc")
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		entry := stscData[8+i*12:]
+		firstChunk := int(binary.BigEndian.Uint32(entry[0:4]))
+		// Chunks count from 1 and entries go in increasing order
+		if firstChunk < 1 || (i > 0 && firstChunk <= chunkMap[i-1].firstChunk) {
+			return fmt.Errorf("mp4: invalid stsc first chunk %d", firstChunk)
+		}
+		chunkMap = append(chunkMap, stscEntry{
+			firstChunk:      firstChunk,
+			samplesPerChunk: int(binary.BigEndian.Uint32(entry[4:8])),
+		})
+	}
+
+	// Resolve the file offset of every sample
+	t.offsets = make([]int64, 0, count)
+	sample := 0
+	for i := 0; i < len(chunkMap) && sample < count; i++ {
+		last := len(chunkOffsets)
+		if i+1 < len(chunkMap) {
+			last = chunkMap[i+1].firstChunk - 1
+		}
+		for chunk := chunkMap[i].firstChunk - 1; chunk < last && chunk < len(chunkOffsets); chunk++ {
+			offset := chunkOffsets[chunk]
+			for s := 0; s < chunkMap[i].samplesPerChunk && sample < count; s++ {
+				if offset < 0 || offset+int64(t.sizes[sample]) > fileSize {
+					return fmt.Errorf("mp4: sample %d lies outside the file", sample)
+				}
+				t.offsets = append(t.offsets, offset)
+				offset += int64(t.sizes[sample])
+				sample++
+			}
+		}
+	}
+	t.sizes = t.sizes[:len(t.offsets)]
+
+	if stts, ok := mp4.Find(boxes, "stts"); ok {
+		data, err := mp4.ReadData(r, stts)
+		if err == nil && len(data) >= 8 {
+			n, err := tableCount(data[4:8], len(data)-8, 8, "stts")
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				t.sampleCounts = append(t.sampleCounts, sttsEntry{
+					count: binary.BigEndian.Uint32(data[8+i*8:]),
+					delta: binary.BigEndian.Uint32(data[12+i*8:]),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// tableCount reads the entry count of a sample table box, checking that
+// entries of entrySize bytes fit in the available bytes after it
+func tableCount(field []byte, available, entrySize int, kind string) (int, error) {
+	n := int64(binary.BigEndian.Uint32(field))
+	if n*int64(entrySize) > int64(available) {
+		return 0, fmt.Errorf("mp4: %s entry count %d exceeds the box", kind, n)
+	}
+	return int(n), nil
+}
+
+// parseEditList reads the encoder delay and playable length from the first
+// non-empty edit, as written by iTunes and most AAC encoders
+func (t *mp4Track) parseEditList(r io.ReaderAt, elst mp4.Box) {
+	data, err := mp4.ReadData(r, elst)
+	if err != nil || len(data) < 8 {
+		return
+	}
+
+	version := data[0]
+	n := int(binary.BigEndian.Uint32(data[4:8]))
+	entrySize := 12
+	if version == 1 {
+		entrySize = 20
+	}
+
+	for i := 0; i < n && 8+i*entrySize+entrySize <= len(data); i++ {
+		entry := data[8+i*entrySize:]
+		var segmentDuration uint64
+		var mediaTime int64
+		if version == 1 {
+			segmentDuration = binary.BigEndian.Uint64(entry[0:8])
+			mediaTime = int64(binary.BigEndian.Uint64(entry[8:16]))
+		} else {
+			segmentDuration = uint64(binary.BigEndian.Uint32(entry[0:4]))
+			mediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:8])))
+		}
+		if mediaTime < 0 {
+			continue // empty edit
+		}
+
+		t.mediaStart = mediaTime
+		if t.movieScale > 0 && segmentDuration > 0 {
+			t.mediaLength = int64(segmentDuration * uint64(t.timescale) / uint64(t.movieScale))
+		}
+		return
+	}
+}
+
+// totalSamples returns the decoded length in media timescale units
+func (t *mp4Track) totalSamples() int64 {
+	var total int64
+	for _, entry := range t.sampleCounts {
+		total += int64(entry.count) * int64(entry.delta)
+	}
+	if total == 0 {
+		total = int64(t.duration)
+	}
+	return total
+}
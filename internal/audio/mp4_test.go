@@ -0,0 +1,121 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/sammwyy/listnr/internal/mp4"
+)
+
+func box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out, uint32(8+len(body)))
+	copy(out[4:], kind)
+	return append(out, body...)
+}
+
+func u32(values ...uint32) []byte {
+	out := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+// sampleTable parses an stbl built from the given boxes
+func sampleTable(t *testing.T, boxes ...[]byte) error {
+	t.Helper()
+	file := bytes.Join(boxes, nil)
+	r := bytes.NewReader(file)
+	children, err := mp4.ReadBoxes(r, 0, int64(len(file)))
+	if err != nil {
+		t.Fatalf("ReadBoxes: %v", err)
+	}
+	return new(mp4Track).parseSampleTable(r, children, int64(len(file)))
+}
+
+func TestParseSampleTable(t *testing.T) {
+	stsz := box("stsz", u32(0, 0, 2, 4, 4))
+	stco := box("stco", u32(0, 1, 0))
+
+	if err := sampleTable(t, stsz, stco, box("stsc", u32(0, 1, 1, 2, 1))); err != nil {
+		t.Fatalf("valid table: %v", err)
+	}
+
+	tests := map[string][][]byte{
+		"first chunk 0":    {stsz, stco, box("stsc", u32(0, 1, 0, 2, 1))},
+		"stsc count":       {stsz, stco, box("stsc", u32(0, 1000, 1, 2, 1))},
+		"stsz count":       {box("stsz", u32(0, 0, 0xffffffff)), stco, box("stsc", u32(0, 0))},
+		"uniform count":    {box("stsz", u32(0, 4, 0xffffffff)), stco, box("stsc", u32(0, 0))},
+		"stco count":       {stsz, box("stco", u32(0, 0xffffffff)), box("stsc", u32(0, 0))},
+		"sample past end":  {stsz, box("stco", u32(0, 1, 1<<20)), box("stsc", u32(0, 1, 1, 2, 1))},
+		"decreasing chunk": {stsz, stco, box("stsc", u32(0, 2, 2, 1, 1, 1, 1, 1))},
+	}
+	for name, boxes := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := sampleTable(t, boxes...); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseESDSTruncatedURL(t *testing.T) {
+	// ES descriptor with URL_Flag set and a URL length past the end
+	data := []byte{0x03, 0x04, 0x00, 0x01, 0x40, 0xff}
+	if _, err := parseESDS(data); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// bits packs fields of {value, width} big-endian into bytes
+func bits(fields ...[2]uint32) []byte {
+	var out []byte
+	pos := 0
+	for _, field := range fields {
+		for i := int(field[1]) - 1; i >= 0; i-- {
+			if pos%8 == 0 {
+				out = append(out, 0)
+			}
+			out[pos/8] |= byte(field[0]>>uint(i)&1) << (7 - uint(pos%8))
+			pos++
+		}
+	}
+	return out
+}
+
+func TestCheckAACProfile(t *testing.T) {
+	// object type, 44.1 kHz, stereo
+	header := func(objectType uint32) [][2]uint32 {
+		return [][2]uint32{{objectType, 5}, {4, 4}, {2, 4}}
+	}
+	lc := append(header(2), [2]uint32{0, 3})
+
+	tests := []struct {
+		name        string
+		asc         []byte
+		unsupported bool
+	}{
+		{"aac-lc", bits(lc...), false},
+		{"he-aac", bits(append(header(5), [2]uint32{4, 4}, [2]uint32{2, 5}, [2]uint32{0, 3})...), true},
+		{"he-aac-v2", bits(append(header(29), [2]uint32{4, 4}, [2]uint32{2, 5}, [2]uint32{0, 3})...), true},
+		{"960-sample-frames", bits(append(header(2), [2]uint32{4, 3})...), true},
+		{"implicit-sbr", bits(append(lc, [2]uint32{0x2b7, 11}, [2]uint32{5, 5}, [2]uint32{1, 1}, [2]uint32{7, 4})...), true},
+		{"no-sbr-extension", bits(append(lc, [2]uint32{0x2b7, 11}, [2]uint32{5, 5}, [2]uint32{0, 1})...), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAACProfile(test.asc)
+			if got := errors.Is(err, ErrUnsupportedFormat); got != test.unsupported {
+				t.Errorf("checkAACProfile(%x) = %v, want unsupported %v", test.asc, err, test.unsupported)
+			}
+		})
+	}
+
+	if err := checkAACProfile([]byte{0x12}); err == nil {
+		t.Error("checkAACProfile accepted a truncated config")
+	}
+}
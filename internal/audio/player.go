@@ -2,32 +2,49 @@ package audio
 
 import (
 	"context"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/sammwyy/listnr/internal/config"
 	"github.com/sammwyy/listnr/internal/events"
 	"github.com/sammwyy/listnr/internal/library"
 
 	"github.com/gopxl/beep"
 	"github.com/gopxl/beep/effects"
-	"github.com/gopxl/beep/speaker"
+)
+
+const (
+	DefaultMinDecibels = -50.0
+	DefaultMaxDecibels = 0.0
 )
 
 type Player struct {
-	// Audio components
+	// Audio components, built once and kept on the sink
+	sink       Sink
 	sampleRate beep.SampleRate
-	streamer   beep.StreamSeekCloser
+	sequencer  *sequencer
+	rate       *rateStreamer
+	equalizer  *Equalizer
 	analyzer   *AudioAnalyzer
 	ctrl       *beep.Ctrl
 	volume     *effects.Volume
-	format     beep.Format
 
 	// State
-	currentSong *library.Song
-	isPlaying   bool
-	volumeLevel float64
+	current      *track
+	next         *track // preloaded for a gapless transition
+	currentSong  *library.Song
+	isPlaying    bool
+	volumeLevel  float64
+	muted        bool
+	minDecibels  float64 // gain at the lowest audible volume level
+	maxDecibels  float64 // gain at full volume
+	rateLevel    float64
+	rateMode     string
+	albumContext bool // an album is playing in order, for automatic ReplayGain
 
 	// Communication
+	config   *config.Config
 	eventBus *events.EventBus
 	commands chan Command
 
@@ -41,23 +58,55 @@ type Command struct {
 }
 
 const (
-	CmdPlay     = "play"
-	CmdPause    = "pause"
-	CmdStop     = "stop"
-	CmdSeek     = "seek"
-	CmdVolume   = "volume"
-	CmdNext     = "next"
-	CmdPrevious = "previous"
+	CmdPlay         = "play"
+	CmdPause        = "pause"
+	CmdStop         = "stop"
+	CmdSeek         = "seek"
+	CmdSeekTo       = "seek_to"
+	CmdSeekFraction = "seek_fraction"
+	CmdVolume       = "volume"
+	CmdMute         = "mute"
+	CmdNext         = "next"
+	CmdPrevious     = "previous"
+	CmdPreload      = "preload"
+	CmdSkip         = "skip"
+	CmdCue          = "cue"
+	CmdAlbumContext = "album_context"
+	CmdEqualizer    = "equalizer"
+	CmdRate         = "rate"
+	CmdRateMode     = "rate_mode"
+	CmdLoop         = "loop"
 )
 
-func NewPlayer(sampleRate beep.SampleRate) *Player {
-	return &Player{
+func NewPlayer(sink Sink, cfg *config.Config) *Player {
+	p := &Player{
+		sink:        sink,
+		config:      cfg,
 		eventBus:    events.NewEventBus(),
 		commands:    make(chan Command, 10),
 		volumeLevel: 0.5,
+		minDecibels: DefaultMinDecibels,
+		maxDecibels: DefaultMaxDecibels,
+		rateLevel:   1,
+		rateMode:    RateStretch,
 		isPlaying:   false,
-		sampleRate:  sampleRate,
+		sampleRate:  sink.SampleRate(),
+	}
+	if cfg.Volume > 0 && cfg.Volume <= 1 {
+		p.volumeLevel = cfg.Volume
+	}
+	// An unset or inverted range keeps the defaults
+	if cfg.VolumeMinDecibels < cfg.VolumeMaxDecibels {
+		p.minDecibels = cfg.VolumeMinDecibels
+		p.maxDecibels = cfg.VolumeMaxDecibels
 	}
+	if cfg.PlaybackRate > 0 {
+		p.rateLevel = clamp(cfg.PlaybackRate, MinRate, MaxRate)
+	}
+	if cfg.RateMode == RateTape {
+		p.rateMode = RateTape
+	}
+	return p
 }
 
 func (p *Player) Start(ctx context.Context) {
@@ -74,20 +123,65 @@ func (p *Player) processCommands(ctx context.Context) {
 			switch cmd.Type {
 			case CmdPlay:
 				if song, ok := cmd.Args.(*library.Song); ok {
-					p.play(song)
+					p.play(song, false)
+				}
+			case CmdSkip:
+				if song, ok := cmd.Args.(*library.Song); ok {
+					p.play(song, true)
+				}
+			case CmdCue:
+				if cue, ok := cmd.Args.(cueArgs); ok {
+					p.cue(cue.song, cue.position)
+				}
+			case CmdPreload:
+				song, _ := cmd.Args.(*library.Song)
+				p.preload(song)
+			case CmdAlbumContext:
+				if album, ok := cmd.Args.(bool); ok {
+					p.setAlbumContext(album)
+				}
+			case CmdEqualizer:
+				if gains, ok := cmd.Args.([]float64); ok {
+					p.setEqualizer(gains)
+				}
+			case CmdRate:
+				if rate, ok := cmd.Args.(float64); ok {
+					p.setRate(rate, "")
+				}
+			case CmdRateMode:
+				if mode, ok := cmd.Args.(string); ok {
+					p.setRate(0, mode)
+				}
+			case CmdLoop:
+				if action, ok := cmd.Args.(string); ok {
+					p.setLoop(action)
 				}
 			case CmdPause:
-				p.togglePlayPause()
+				if paused, ok := cmd.Args.(bool); ok {
+					p.setPaused(paused)
+				} else {
+					p.togglePlayPause()
+				}
 			case CmdStop:
 				p.stop()
 			case CmdSeek:
 				if duration, ok := cmd.Args.(time.Duration); ok {
 					p.seek(duration)
 				}
+			case CmdSeekTo:
+				if position, ok := cmd.Args.(time.Duration); ok {
+					p.seekTo(position)
+				}
+			case CmdSeekFraction:
+				if fraction, ok := cmd.Args.(float64); ok {
+					p.seekFraction(fraction)
+				}
 			case CmdVolume:
 				if level, ok := cmd.Args.(float64); ok {
 					p.setVolume(level)
 				}
+			case CmdMute:
+				p.toggleMute()
 			}
 		}
 	}
@@ -103,19 +197,15 @@ func (p *Player) updateProgress(ctx context.Context) {
 			return
 		case <-ticker.C:
 			p.mu.RLock()
-			if p.streamer != nil && p.isPlaying {
-				position := p.streamer.Position()
-				total := p.streamer.Len()
-
-				if position >= total-1000 {
-					p.eventBus.Publish(events.Event{
-						Type: events.SongEnded,
-						Data: events.SongEndedData{Song: p.currentSong},
-					})
-				}
+			if p.current != nil && p.isPlaying {
+				p.sink.Lock()
+				position := p.current.decoder.Position()
+				total := p.current.decoder.Len()
+				p.sink.Unlock()
+				sampleRate := p.current.format.SampleRate
 
-				currentTime := time.Duration(position) * time.Second / time.Duration(p.format.SampleRate)
-				totalTime := time.Duration(total) * time.Second / time.Duration(p.format.SampleRate)
+				currentTime := time.Duration(position) * time.Second / time.Duration(sampleRate)
+				totalTime := time.Duration(total) * time.Second / time.Duration(sampleRate)
 
 				p.eventBus.Publish(events.Event{
 					Type: events.ProgressUpdated,
@@ -131,53 +221,425 @@ func (p *Player) updateProgress(ctx context.Context) {
 	}
 }
 
-func (p *Player) play(song *library.Song) {
+// play starts song, where it was left off if a resume position is kept for
+// it. Manual skips crossfade from the playing song when a manual crossfade
+// is configured.
+func (p *Player) play(song *library.Song, skip bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Stop current playback
-	p.stopInternal()
-
 	// Decode new file
-	streamer, format, err := DecodeFile(song.Path)
+	t, err := openTrack(song, p.sampleRate, p.config.Resampler)
 	if err != nil {
+		// Don't leave the previous song playing as if nothing was asked
+		p.stopInternal()
+		p.eventBus.Publish(events.Event{
+			Type: events.SongChanged,
+			Data: events.SongData{Song: nil},
+		})
+		p.eventBus.Publish(events.Event{
+			Type: events.PlaybackError,
+			Data: events.ErrorData{Kind: events.ErrorDecode, Song: song, Err: err},
+		})
 		return
 	}
+	t.gain.Gain = p.replayGain(song) - 1
+	if p.switchSampleRate(t.format.SampleRate) {
+		t.setOutputRate(p.sampleRate, p.config.Resampler)
+	}
+	p.resume(t)
+
+	fade := p.sampleRate.N(time.Duration(p.config.ManualCrossfadeSeconds * float64(time.Second)))
+	if skip && fade > 0 && p.current != nil && p.isPlaying {
+		p.sink.Lock()
+		p.sequencer.crossfadeTo(t, fade)
+		next := p.sequencer.next
+		p.sequencer.next = nil
+		p.sink.Unlock()
 
-	// Resample if needed
-	var rs beep.Streamer
-	if format.SampleRate != p.sampleRate {
-		rs = beep.Resample(3, format.SampleRate, p.sampleRate, streamer)
+		next.Close()
+		p.next = nil
 	} else {
-		rs = streamer
+		// Stop current playback
+		p.stopInternal()
+		p.ensurePipeline()
+
+		p.sink.Lock()
+		p.sequencer.current = t
+		p.ctrl.Paused = false
+		p.sink.Unlock()
 	}
 
-	// Setup audio analyzer
-	p.analyzer = NewAudioAnalyzer(rs, p.eventBus)
+	p.current = t
+	p.currentSong = song
+	p.isPlaying = true
 
-	// Setup player components
-	p.streamer = streamer
-	p.format = format
+	// Notify UI
+	p.eventBus.Publish(events.Event{
+		Type: events.SongChanged,
+		Data: events.SongData{Song: song},
+	})
+	p.publishLoop(t)
+	p.eventBus.Publish(events.Event{
+		Type: events.PlaybackResumed,
+		Data: events.PlaybackData{IsPlaying: true},
+	})
+}
+
+// resume seeks t to where its song was left off, if it's long enough to
+// keep the position for and wasn't finished
+func (p *Player) resume(t *track) {
+	resume := t.song.Resume()
+	min := p.config.ResumeMinDuration()
+	if resume == nil || resume.Finished() || min == 0 || resume.Duration < min {
+		return
+	}
+	if pos := t.format.SampleRate.N(resume.Position); pos > 0 && pos < t.decoder.Len() {
+		t.seek(pos)
+	}
+}
+
+type cueArgs struct {
+	song     *library.Song
+	position time.Duration
+}
+
+// cue loads song paused at position, so TogglePlayPause continues from there
+func (p *Player) cue(song *library.Song, position time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, err := openTrack(song, p.sampleRate, p.config.Resampler)
+	if err != nil {
+		p.eventBus.Publish(events.Event{
+			Type: events.PlaybackError,
+			Data: events.ErrorData{Kind: events.ErrorDecode, Song: song, Err: err},
+		})
+		return
+	}
+	t.gain.Gain = p.replayGain(song) - 1
+	if p.switchSampleRate(t.format.SampleRate) {
+		t.setOutputRate(p.sampleRate, p.config.Resampler)
+	}
+	if pos := t.format.SampleRate.N(position); pos > 0 && pos < t.decoder.Len() {
+		t.seek(pos)
+	}
+
+	p.stopInternal()
+	p.ensurePipeline()
+
+	p.sink.Lock()
+	p.sequencer.current = t
+	p.ctrl.Paused = true
+	total := t.format.SampleRate.D(t.decoder.Len())
+	current := t.format.SampleRate.D(t.decoder.Position())
+	p.sink.Unlock()
+
+	p.current = t
 	p.currentSong = song
+	p.isPlaying = false
+
+	p.eventBus.Publish(events.Event{
+		Type: events.SongChanged,
+		Data: events.SongData{Song: song},
+	})
+	p.publishLoop(t)
+	p.eventBus.Publish(events.Event{
+		Type: events.PlaybackPaused,
+		Data: events.PlaybackData{IsPlaying: false},
+	})
+	// Progress is only polled while playing
+	p.eventBus.Publish(events.Event{
+		Type: events.ProgressUpdated,
+		Data: events.ProgressData{Current: current, Total: total, Song: song},
+	})
+}
+
+// ensurePipeline builds the streamer chain on first use. It stays on the
+// sink for the player's lifetime; tracks are swapped in the sequencer.
+func (p *Player) ensurePipeline() {
+	if p.sequencer != nil {
+		return
+	}
+
+	p.sequencer = &sequencer{
+		crossfade:  p.sampleRate.N(time.Duration(p.config.CrossfadeSeconds * float64(time.Second))),
+		curve:      p.config.CrossfadeCurve,
+		sampleRate: p.sampleRate,
+		// Called on the audio thread, which must not wait for p.mu or file I/O
+		advance: func(ended, started *track) {
+			go p.advance(ended, started)
+		},
+		release: func(t *track) {
+			go t.Close()
+		},
+		ended: func(t *track) {
+			go p.ended(t)
+		},
+	}
+	p.rate = newRateStreamer(p.sequencer, p.sampleRate, p.rateLevel, p.rateMode)
+	p.equalizer = NewEqualizer(p.rate, p.sampleRate, p.config.EqualizerGains)
+	p.analyzer = NewAudioAnalyzer(p.equalizer, p.eventBus, p.sampleRate, p.config.VisualizerBands)
 	p.ctrl = &beep.Ctrl{Streamer: p.analyzer, Paused: false}
 	p.volume = &effects.Volume{
 		Streamer: p.ctrl,
-		Base:     2,
-		Volume:   p.volumeToDecibels(p.volumeLevel),
-		Silent:   false,
+		Base:     10,
 	}
-	p.isPlaying = true
+	p.applyVolume()
 
-	speaker.Play(p.volume)
+	p.sink.Play(p.volume)
+}
 
-	// Notify UI
+// canSwitchSampleRate reports whether the output should and can be reopened
+// at rate rather than resampling to the current rate
+func (p *Player) canSwitchSampleRate(rate beep.SampleRate) bool {
+	return p.config.NativeSampleRate && rate != p.sampleRate && p.sink.CanSetSampleRate()
+}
+
+// switchSampleRate reopens the output at rate when playing at native rates.
+// Playback stops and the pipeline is rebuilt at the new rate on next use.
+func (p *Player) switchSampleRate(rate beep.SampleRate) bool {
+	if !p.canSwitchSampleRate(rate) || p.sink.SetSampleRate(rate) != nil {
+		return false
+	}
+
+	p.stopInternal()
+	p.sampleRate = rate
+	p.sequencer, p.rate, p.equalizer, p.analyzer, p.ctrl, p.volume = nil, nil, nil, nil, nil, nil
+	return true
+}
+
+// preload decodes song ahead of time so the sequencer can start it the
+// moment the current track ends. A nil song drops any preloaded track.
+func (p *Player) preload(song *library.Song) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil {
+		return
+	}
+	if p.next != nil && p.next.song == song {
+		return
+	}
+
+	var t *track
+	if song != nil {
+		var err error
+		if t, err = openTrack(song, p.sampleRate, p.config.Resampler); err != nil {
+			// Fall back to starting the song once the current one ends
+			t = nil
+		} else if p.canSwitchSampleRate(t.format.SampleRate) {
+			// Let the current song end so the next one reopens the output
+			// at its own rate
+			t.Close()
+			t = nil
+		} else {
+			t.gain.Gain = p.replayGain(song) - 1
+			// Repeating a song starts it over
+			if song != p.currentSong {
+				p.resume(t)
+			}
+		}
+	}
+
+	p.sink.Lock()
+	switched := p.sequencer.current != p.current
+	if !switched {
+		p.sequencer.next = t
+	}
+	p.sink.Unlock()
+
+	// The sequencer already started p.next; advance will catch up
+	if switched {
+		t.Close()
+		return
+	}
+
+	p.next.Close()
+	p.next = t
+}
+
+// advance records a gapless or crossfaded switch made by the sequencer
+func (p *Player) advance(ended, started *track) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A song started in the meantime replaced the preloaded track
+	if started != p.next {
+		return
+	}
+
+	p.current = started
+	p.next = nil
+	p.currentSong = started.song
+
+	p.publishDecoderError(ended)
+	p.eventBus.Publish(events.Event{
+		Type: events.SongEnded,
+		Data: events.SongEndedData{Song: ended.song, Next: started.song},
+	})
 	p.eventBus.Publish(events.Event{
 		Type: events.SongChanged,
-		Data: events.SongData{Song: song},
+		Data: events.SongData{Song: started.song},
 	})
+	p.publishLoop(started)
+}
+
+// ended reports the end of a track the sequencer had nothing to follow with
+func (p *Player) ended(t *track) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Playback moved on before the report arrived
+	if t != p.current {
+		return
+	}
+
+	p.isPlaying = false
 	p.eventBus.Publish(events.Event{
-		Type: events.PlaybackResumed,
-		Data: events.PlaybackData{IsPlaying: true},
+		Type: events.PlaybackPaused,
+		Data: events.PlaybackData{IsPlaying: false},
+	})
+	p.publishDecoderError(t)
+	p.eventBus.Publish(events.Event{
+		Type: events.SongEnded,
+		Data: events.SongEndedData{Song: t.song},
+	})
+}
+
+// publishDecoderError reports a track that stopped early because its
+// decoder failed
+func (p *Player) publishDecoderError(t *track) {
+	p.sink.Lock()
+	err := t.decoder.Err()
+	p.sink.Unlock()
+
+	if err != nil {
+		p.eventBus.Publish(events.Event{
+			Type: events.PlaybackError,
+			Data: events.ErrorData{Kind: events.ErrorPlayback, Song: t.song, Err: err},
+		})
+	}
+}
+
+func (p *Player) replayGain(song *library.Song) float64 {
+	return replayGainFactor(song, p.config.ReplayGainMode, p.albumContext, p.config.ReplayGainPreamp)
+}
+
+// setAlbumContext switches automatic ReplayGain between album and track gain,
+// including for the tracks already loaded
+func (p *Player) setAlbumContext(album bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.albumContext == album {
+		return
+	}
+	p.albumContext = album
+
+	p.sink.Lock()
+	defer p.sink.Unlock()
+	for _, t := range []*track{p.current, p.next} {
+		if t != nil {
+			t.gain.Gain = p.replayGain(t.song) - 1
+		}
+	}
+}
+
+func (p *Player) setEqualizer(gains []float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Before the first song the gains are picked up from the config
+	if p.equalizer == nil {
+		return
+	}
+
+	p.sink.Lock()
+	p.equalizer.SetGains(gains)
+	p.sink.Unlock()
+}
+
+// setRate changes the playback speed and/or mode; a zero rate or empty mode
+// keeps the current one
+func (p *Player) setRate(rate float64, mode string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if rate > 0 {
+		// Round away float drift from repeated steps
+		p.rateLevel = clamp(math.Round(rate*100)/100, MinRate, MaxRate)
+	}
+	if mode == RateTape || mode == RateStretch {
+		p.rateMode = mode
+	}
+
+	if p.rate != nil {
+		p.sink.Lock()
+		p.rate.SetRate(p.rateLevel, p.rateMode)
+		p.sink.Unlock()
+	}
+
+	p.eventBus.Publish(events.Event{
+		Type: events.RateChanged,
+		Data: events.RateData{Rate: p.rateLevel, Mode: p.rateMode},
+	})
+}
+
+// setLoop moves the A-B loop points of the current track to the playback
+// position, see LoopStart and friends
+func (p *Player) setLoop(action string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil {
+		return
+	}
+	loop := p.current.loop
+
+	p.sink.Lock()
+	pos := p.current.decoder.Position()
+	if action == LoopCycle {
+		switch {
+		case loop.start < 0:
+			action = LoopStart
+		case loop.end < 0:
+			action = LoopEnd
+		default:
+			action = LoopClear
+		}
+	}
+
+	switch action {
+	case LoopStart:
+		loop.start = pos
+		if loop.end <= pos {
+			loop.end = -1
+		}
+	case LoopEnd:
+		if loop.start < 0 {
+			loop.start = 0
+		}
+		// B before A would be an empty loop
+		if pos > loop.start {
+			loop.end = pos
+		}
+	case LoopClear:
+		loop.start, loop.end = -1, -1
+	}
+	p.sink.Unlock()
+
+	p.publishLoop(p.current)
+}
+
+func (p *Player) publishLoop(t *track) {
+	p.sink.Lock()
+	start, end := t.loop.points(t.format.SampleRate)
+	p.sink.Unlock()
+
+	p.eventBus.Publish(events.Event{
+		Type: events.LoopChanged,
+		Data: events.LoopData{Song: t.song, Start: start, End: end},
 	})
 }
 
@@ -186,10 +648,17 @@ func (p *Player) togglePlayPause() {
 	defer p.mu.Unlock()
 
 	if p.ctrl != nil {
-		speaker.Lock()
-		p.ctrl.Paused = !p.ctrl.Paused
+		p.sink.Lock()
+		if p.current != nil && p.current.drained {
+			// Play a finished song again from the start
+			p.current.seek(0)
+			p.current.drained = false
+			p.ctrl.Paused = false
+		} else {
+			p.ctrl.Paused = !p.ctrl.Paused
+		}
 		p.isPlaying = !p.ctrl.Paused
-		speaker.Unlock()
+		p.sink.Unlock()
 
 		if p.isPlaying {
 			p.eventBus.Publish(events.Event{
@@ -205,20 +674,49 @@ func (p *Player) togglePlayPause() {
 	}
 }
 
+// setPaused pauses or resumes playback unless it already is
+func (p *Player) setPaused(paused bool) {
+	p.mu.RLock()
+	playing := p.isPlaying
+	p.mu.RUnlock()
+
+	if playing == paused {
+		p.togglePlayPause()
+	}
+}
+
 func (p *Player) stop() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+
+	if p.current == nil {
+		return
+	}
 	p.stopInternal()
+	p.eventBus.Publish(events.Event{
+		Type: events.SongChanged,
+		Data: events.SongData{Song: nil},
+	})
 }
 
 func (p *Player) stopInternal() {
-	if p.streamer != nil {
-		speaker.Clear()
-		p.streamer.Close()
-		p.streamer = nil
+	if p.current != nil {
+		p.sink.Lock()
+		current, next, outgoing := p.sequencer.current, p.sequencer.next, p.sequencer.outgoing
+		p.sequencer.current = nil
+		p.sequencer.next = nil
+		p.sequencer.outgoing = nil
+		p.sink.Unlock()
+
+		current.Close()
+		next.Close()
+		outgoing.Close()
+		p.current.Close()
+		p.next.Close()
+		p.current = nil
+		p.next = nil
 		p.currentSong = nil
 		p.isPlaying = false
-		p.analyzer = nil
 
 		p.eventBus.Publish(events.Event{
 			Type: events.PlaybackPaused,
@@ -228,23 +726,66 @@ func (p *Player) stopInternal() {
 }
 
 func (p *Player) seek(offset time.Duration) {
+	p.seekSample(func(t *track) int {
+		return t.decoder.Position() + int(offset.Seconds()*float64(t.format.SampleRate))
+	})
+}
+
+func (p *Player) seekTo(position time.Duration) {
+	p.seekSample(func(t *track) int {
+		return int(position.Seconds() * float64(t.format.SampleRate))
+	})
+}
+
+// seekFraction jumps to a fraction of the track length, 0.5 being the middle
+func (p *Player) seekFraction(fraction float64) {
+	p.seekSample(func(t *track) int {
+		return int(clamp(fraction, 0, 1) * float64(t.decoder.Len()))
+	})
+}
+
+// seekSample moves the current track to the decoder sample returned by
+// target, which is called under the sink lock
+func (p *Player) seekSample(target func(t *track) int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.streamer != nil {
-		speaker.Lock()
-		current := p.streamer.Position()
-		newPos := current + int(offset.Seconds()*float64(p.format.SampleRate))
+	if p.current != nil {
+		decoder := p.current.decoder
+
+		p.sink.Lock()
+		newPos := target(p.current)
 
 		if newPos < 0 {
 			newPos = 0
 		}
-		if newPos >= p.streamer.Len() {
-			newPos = p.streamer.Len() - 1
+		if newPos >= decoder.Len() {
+			newPos = decoder.Len() - 1
 		}
 
-		p.streamer.Seek(newPos)
-		speaker.Unlock()
+		p.current.seek(newPos)
+		// Some decoders land on the frame before the target
+		position := decoder.Position()
+		// Seeking back into a finished track plays it again until it ends
+		resumed := p.current.drained && newPos < decoder.Len()-1 && !p.ctrl.Paused
+		p.current.drained = false
+		p.sink.Unlock()
+
+		p.eventBus.Publish(events.Event{
+			Type: events.Seeked,
+			Data: events.SeekData{
+				Song:     p.currentSong,
+				Position: p.current.format.SampleRate.D(position),
+			},
+		})
+
+		if resumed {
+			p.isPlaying = true
+			p.eventBus.Publish(events.Event{
+				Type: events.PlaybackResumed,
+				Data: events.PlaybackData{IsPlaying: true},
+			})
+		}
 	}
 }
 
@@ -252,25 +793,54 @@ func (p *Player) setVolume(level float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.volumeLevel = clamp(level, 0.0, 1.0)
+	// Round away float drift from repeated steps so the bottom step is silent
+	p.volumeLevel = clamp(math.Round(level*100)/100, 0.0, 1.0)
+	// Changing the volume ends a mute
+	p.muted = false
+
+	if p.volume != nil {
+		p.sink.Lock()
+		p.applyVolume()
+		p.sink.Unlock()
+	}
+	p.publishVolume()
+}
+
+// toggleMute silences playback without losing the volume level
+func (p *Player) toggleMute() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.muted = !p.muted
 
 	if p.volume != nil {
-		speaker.Lock()
-		p.volume.Volume = p.volumeToDecibels(p.volumeLevel)
-		speaker.Unlock()
+		p.sink.Lock()
+		p.applyVolume()
+		p.sink.Unlock()
 	}
+	p.publishVolume()
+}
 
+// applyVolume sets the volume effect from the level, under the sink lock
+// once playing
+func (p *Player) applyVolume() {
+	p.volume.Volume = p.volumeToDecibels(p.volumeLevel) / 20
+	p.volume.Silent = p.muted || p.volumeLevel == 0
+}
+
+func (p *Player) publishVolume() {
 	p.eventBus.Publish(events.Event{
 		Type: events.VolumeChanged,
-		Data: events.VolumeData{Level: p.volumeLevel},
+		Data: events.VolumeData{Level: p.volumeLevel, Muted: p.muted},
 	})
 }
 
+// volumeToDecibels maps a 0-1 volume level to a gain in dB. Loudness is
+// perceived logarithmically, so equal steps in dB sound like equal steps
+// in volume; the level is spread linearly over the dB range. Level 0 is
+// silenced separately.
 func (p *Player) volumeToDecibels(volume float64) float64 {
-	if volume == 0 {
-		return -10 // Silent
-	}
-	return (volume - 1) * 5 // Convert 0-1 to -5-0 dB range
+	return p.minDecibels + (p.maxDecibels-p.minDecibels)*volume
 }
 
 // Public API methods
@@ -278,10 +848,42 @@ func (p *Player) Play(song *library.Song) {
 	p.commands <- Command{Type: CmdPlay, Args: song}
 }
 
+// Skip starts song like Play, crossfading when a manual crossfade is configured
+func (p *Player) Skip(song *library.Song) {
+	p.commands <- Command{Type: CmdSkip, Args: song}
+}
+
+// Cue loads song paused at position, e.g. to resume a previous session
+func (p *Player) Cue(song *library.Song, position time.Duration) {
+	p.commands <- Command{Type: CmdCue, Args: cueArgs{song: song, position: position}}
+}
+
+// SetAlbumContext tells the player whether songs are playing in album order,
+// selecting album gain in automatic ReplayGain mode
+func (p *Player) SetAlbumContext(album bool) {
+	p.commands <- Command{Type: CmdAlbumContext, Args: album}
+}
+
+// SetEqualizer sets the equalizer band gains in dB, see EqualizerFrequencies
+func (p *Player) SetEqualizer(gains []float64) {
+	p.commands <- Command{Type: CmdEqualizer, Args: gains}
+}
+
+// Preload prepares the song expected to play after the current one, or
+// cancels a previous preload when song is nil
+func (p *Player) Preload(song *library.Song) {
+	p.commands <- Command{Type: CmdPreload, Args: song}
+}
+
 func (p *Player) TogglePlayPause() {
 	p.commands <- Command{Type: CmdPause}
 }
 
+// SetPaused pauses or resumes playback, doing nothing if it already is
+func (p *Player) SetPaused(paused bool) {
+	p.commands <- Command{Type: CmdPause, Args: paused}
+}
+
 func (p *Player) Stop() {
 	p.commands <- Command{Type: CmdStop}
 }
@@ -294,6 +896,21 @@ func (p *Player) SeekBackward() {
 	p.commands <- Command{Type: CmdSeek, Args: -5 * time.Second}
 }
 
+// SeekTo jumps to position from the start of the current song
+func (p *Player) SeekTo(position time.Duration) {
+	p.commands <- Command{Type: CmdSeekTo, Args: position}
+}
+
+// SeekFraction jumps to a fraction between 0 and 1 of the current song
+func (p *Player) SeekFraction(fraction float64) {
+	p.commands <- Command{Type: CmdSeekFraction, Args: fraction}
+}
+
+// SetVolume sets the volume level, between 0 and 1
+func (p *Player) SetVolume(level float64) {
+	p.commands <- Command{Type: CmdVolume, Args: level}
+}
+
 func (p *Player) VolumeUp() {
 	p.mu.RLock()
 	newVolume := p.volumeLevel + 0.05
@@ -308,6 +925,65 @@ func (p *Player) VolumeDown() {
 	p.commands <- Command{Type: CmdVolume, Args: newVolume}
 }
 
+// SetRate sets the playback speed, between MinRate and MaxRate
+func (p *Player) SetRate(rate float64) {
+	p.commands <- Command{Type: CmdRate, Args: rate}
+}
+
+func (p *Player) RateUp() {
+	p.mu.RLock()
+	newRate := p.rateLevel + 0.1
+	p.mu.RUnlock()
+	p.commands <- Command{Type: CmdRate, Args: newRate}
+}
+
+func (p *Player) RateDown() {
+	p.mu.RLock()
+	newRate := p.rateLevel - 0.1
+	p.mu.RUnlock()
+	p.commands <- Command{Type: CmdRate, Args: newRate}
+}
+
+// SetRateMode selects RateTape or RateStretch
+func (p *Player) SetRateMode(mode string) {
+	p.commands <- Command{Type: CmdRateMode, Args: mode}
+}
+
+func (p *Player) ToggleRateMode() {
+	p.mu.RLock()
+	mode := RateTape
+	if p.rateMode == RateTape {
+		mode = RateStretch
+	}
+	p.mu.RUnlock()
+	p.commands <- Command{Type: CmdRateMode, Args: mode}
+}
+
+// SetLoopStart sets point A of the A-B loop at the current position
+func (p *Player) SetLoopStart() {
+	p.commands <- Command{Type: CmdLoop, Args: LoopStart}
+}
+
+// SetLoopEnd sets point B at the current position, looping back to A from
+// then on
+func (p *Player) SetLoopEnd() {
+	p.commands <- Command{Type: CmdLoop, Args: LoopEnd}
+}
+
+func (p *Player) ClearLoop() {
+	p.commands <- Command{Type: CmdLoop, Args: LoopClear}
+}
+
+// CycleLoop sets point A, then point B, then clears the loop
+func (p *Player) CycleLoop() {
+	p.commands <- Command{Type: CmdLoop, Args: LoopCycle}
+}
+
+// ToggleMute silences or restores playback, keeping the volume level
+func (p *Player) ToggleMute() {
+	p.commands <- Command{Type: CmdMute}
+}
+
 func (p *Player) EventBus() *events.EventBus {
 	return p.eventBus
 }
@@ -318,6 +994,34 @@ func (p *Player) CurrentSong() *library.Song {
 	return p.currentSong
 }
 
+// Position returns how far into the current song playback is
+func (p *Player) Position() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current == nil {
+		return 0
+	}
+	p.sink.Lock()
+	position := p.current.decoder.Position()
+	p.sink.Unlock()
+	return p.current.format.SampleRate.D(position)
+}
+
+// Duration returns the length of the current song
+func (p *Player) Duration() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current == nil {
+		return 0
+	}
+	p.sink.Lock()
+	length := p.current.decoder.Len()
+	p.sink.Unlock()
+	return p.current.format.SampleRate.D(length)
+}
+
 func (p *Player) IsPlaying() bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -330,6 +1034,18 @@ func (p *Player) Volume() float64 {
 	return p.volumeLevel
 }
 
+func (p *Player) Muted() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.muted
+}
+
+func (p *Player) Rate() (float64, string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rateLevel, p.rateMode
+}
+
 func clamp(value, min, max float64) float64 {
 	if value < min {
 		return min
@@ -0,0 +1,220 @@
+package audio
+
+import (
+	"math"
+	"time"
+
+	"github.com/gopxl/beep"
+)
+
+const (
+	RateTape    = "tape"    // pitch follows speed
+	RateStretch = "stretch" // pitch is preserved
+
+	MinRate = 0.5
+	MaxRate = 3.0
+)
+
+// rateStreamer changes the playback speed of everything streamed through it
+type rateStreamer struct {
+	source     beep.Streamer
+	sampleRate beep.SampleRate
+	rate       float64
+	mode       string
+
+	tape    *beep.Resampler
+	stretch *wsola
+}
+
+func newRateStreamer(source beep.Streamer, sampleRate beep.SampleRate, rate float64, mode string) *rateStreamer {
+	r := &rateStreamer{source: source, sampleRate: sampleRate}
+	r.SetRate(rate, mode)
+	return r
+}
+
+// SetRate changes speed and mode. Callers streaming through a sink must
+// hold its lock.
+func (r *rateStreamer) SetRate(rate float64, mode string) {
+	if rate <= 0 {
+		rate = 1
+	}
+	rate = clamp(rate, MinRate, MaxRate)
+	if mode != RateTape {
+		mode = RateStretch
+	}
+
+	// Buffered audio of a processor that is no longer used is dropped
+	if mode != r.mode || rate == 1 {
+		r.tape = nil
+		r.stretch = nil
+	}
+	r.rate = rate
+	r.mode = mode
+
+	if r.tape != nil {
+		r.tape.SetRatio(rate)
+	}
+	if r.stretch != nil {
+		r.stretch.rate = rate
+	}
+}
+
+func (r *rateStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if r.rate == 1 {
+		return r.source.Stream(samples)
+	}
+
+	if r.mode == RateTape {
+		if r.tape == nil {
+			r.tape = beep.ResampleRatio(4, r.rate, r.source)
+		}
+		return r.tape.Stream(samples)
+	}
+
+	if r.stretch == nil {
+		r.stretch = newWSOLA(r.source, r.sampleRate, r.rate)
+	}
+	return r.stretch.Stream(samples)
+}
+
+func (r *rateStreamer) Err() error {
+	return nil
+}
+
+// wsola time-stretches audio without changing its pitch using waveform
+// similarity overlap-add: frames are taken from the input at rate times the
+// output hop, each shifted within a small tolerance to best continue the
+// previous frame, and overlap-added with a Hann window.
+type wsola struct {
+	source beep.Streamer
+	rate   float64
+
+	frame     int
+	hop       int
+	tolerance int
+	window    []float64
+
+	in      [][2]float64 // buffered input
+	pos     float64      // nominal input position of the next frame
+	prev    int          // input position of the previous frame, -1 before the first
+	out     [][2]float64 // overlap-add accumulator
+	ready   [][2]float64 // finished output
+	drained bool
+}
+
+func newWSOLA(source beep.Streamer, sampleRate beep.SampleRate, rate float64) *wsola {
+	frame := sampleRate.N(40*time.Millisecond) &^ 1
+	w := &wsola{
+		source:    source,
+		rate:      rate,
+		frame:     frame,
+		hop:       frame / 2,
+		tolerance: sampleRate.N(10 * time.Millisecond),
+		window:    make([]float64, frame),
+		prev:      -1,
+		out:       make([][2]float64, frame),
+	}
+	// Periodic Hann windows at 50% overlap sum to one
+	for i := range w.window {
+		w.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frame))
+	}
+	return w
+}
+
+func (w *wsola) Stream(samples [][2]float64) (n int, ok bool) {
+	for len(w.ready) < len(samples) && !w.drained {
+		w.step()
+	}
+
+	n = copy(samples, w.ready)
+	w.ready = w.ready[n:]
+	return n, n > 0 || !w.drained
+}
+
+func (w *wsola) Err() error {
+	return nil
+}
+
+// fill reads input until at least size samples are buffered
+func (w *wsola) fill(size int) bool {
+	buf := make([][2]float64, 1024)
+	for len(w.in) < size {
+		n, ok := w.source.Stream(buf)
+		w.in = append(w.in, buf[:n]...)
+		if !ok || n == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *wsola) step() {
+	nominal := int(w.pos)
+	need := nominal + w.tolerance + w.frame
+	if w.prev >= 0 && w.prev+w.hop+w.frame > need {
+		need = w.prev + w.hop + w.frame
+	}
+	if !w.fill(need) {
+		w.flush()
+		return
+	}
+
+	start := nominal
+	if w.prev >= 0 {
+		start = w.bestMatch(nominal, w.prev+w.hop)
+	}
+
+	for i := 0; i < w.frame; i++ {
+		w.out[i][0] += w.in[start+i][0] * w.window[i]
+		w.out[i][1] += w.in[start+i][1] * w.window[i]
+	}
+
+	w.ready = append(w.ready, w.out[:w.hop]...)
+	copy(w.out, w.out[w.hop:])
+	for i := w.frame - w.hop; i < w.frame; i++ {
+		w.out[i] = [2]float64{}
+	}
+
+	w.prev = start
+	w.pos += float64(w.hop) * w.rate
+
+	// Drop input no later frame can reach
+	if drop := min(w.prev, int(w.pos)-w.tolerance); drop > 0 {
+		w.in = w.in[drop:]
+		w.prev -= drop
+		w.pos -= float64(drop)
+	}
+}
+
+// bestMatch returns the frame start within the tolerance around nominal whose
+// overlap region is most similar to the natural continuation at target
+func (w *wsola) bestMatch(nominal, target int) int {
+	best, bestScore := nominal, math.Inf(-1)
+	overlap := w.frame - w.hop
+
+	for start := nominal - w.tolerance; start <= nominal+w.tolerance; start++ {
+		if start < 0 {
+			continue
+		}
+		// Normalized cross-correlation; every other sample is plenty to
+		// find the alignment
+		var correlation, energy float64
+		for i := 0; i < overlap; i += 2 {
+			a := w.in[start+i][0] + w.in[start+i][1]
+			b := w.in[target+i][0] + w.in[target+i][1]
+			correlation += a * b
+			energy += a * a
+		}
+		score := correlation / math.Sqrt(energy+1e-9)
+		if score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	return best
+}
+
+// flush emits what is left in the accumulator once the source is drained
+func (w *wsola) flush() {
+	w.ready = append(w.ready, w.out[:w.frame-w.hop]...)
+	w.drained = true
+}
@@ -0,0 +1,47 @@
+package audio
+
+import (
+	"math"
+
+	"github.com/sammwyy/listnr/internal/library"
+)
+
+const (
+	ReplayGainOff   = "off"
+	ReplayGainTrack = "track"
+	ReplayGainAlbum = "album"
+	ReplayGainAuto  = "auto" // album gain while an album plays in order, track gain otherwise
+)
+
+// replayGainFactor returns the linear gain to apply to song. The gain is
+// lowered when needed so the tagged peak doesn't clip.
+func replayGainFactor(song *library.Song, mode string, albumContext bool, preamp float64) float64 {
+	album := mode == ReplayGainAlbum || (mode == ReplayGainAuto && albumContext)
+
+	var gain *library.Gain
+	switch {
+	case mode == "" || mode == ReplayGainOff:
+		return 1
+	case album && song.AlbumGain != nil:
+		gain = song.AlbumGain
+	case song.TrackGain != nil:
+		gain = song.TrackGain
+	case song.AlbumGain != nil:
+		// Use whatever is tagged rather than nothing
+		gain = song.AlbumGain
+	default:
+		// Untagged songs fall back to their EBU R128 measurement
+		if loudness := song.Loudness(); loudness != nil {
+			gain = loudness.Gain()
+		}
+	}
+	if gain == nil {
+		return 1
+	}
+
+	factor := math.Pow(10, (gain.Gain+preamp)/20)
+	if gain.Peak > 0 {
+		factor = math.Min(factor, 1/gain.Peak)
+	}
+	return factor
+}
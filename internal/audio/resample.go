@@ -0,0 +1,159 @@
+package audio
+
+import (
+	"math"
+
+	"github.com/gopxl/beep"
+)
+
+const (
+	ResamplerFast = "fast" // low-order polynomial interpolation, cheap
+	ResamplerSinc = "sinc" // windowed sinc, transparent
+
+	sincTaps       = 32  // kernel half-width in input samples
+	sincResolution = 256 // kernel table entries per input sample
+	sincBeta       = 9.0 // Kaiser window shape, about 90 dB stopband
+)
+
+// sincTable holds the right half of the Kaiser-windowed sinc kernel
+var sincTable = makeSincTable()
+
+func makeSincTable() []float64 {
+	table := make([]float64, sincTaps*sincResolution+2)
+	norm := besselI0(sincBeta)
+	for i := range table {
+		x := float64(i) / sincResolution
+		if x >= sincTaps {
+			continue
+		}
+		r := x / sincTaps
+		window := besselI0(sincBeta*math.Sqrt(1-r*r)) / norm
+		table[i] = sinc(x) * window
+	}
+	return table
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+// newResampler converts source from one sample rate to another with the
+// given resampler
+func newResampler(resampler string, from, to beep.SampleRate, source beep.Streamer) beep.Streamer {
+	if resampler == ResamplerFast {
+		return beep.Resample(3, from, to, source)
+	}
+	return newSincResampler(from, to, source)
+}
+
+// sincResampler is a band-limited resampler. When downsampling the kernel
+// is widened so content above the new Nyquist frequency is filtered out
+// instead of aliasing.
+type sincResampler struct {
+	source beep.Streamer
+	step   float64 // input samples per output sample
+	scale  float64 // kernel compression, below 1 when downsampling
+	width  int     // input samples on either side of an output sample
+
+	in      [][2]float64 // input from index start on
+	start   int
+	pos     float64 // input position of the next output sample
+	end     int     // input length once the source is drained, else -1
+	readBuf [][2]float64
+}
+
+func newSincResampler(from, to beep.SampleRate, source beep.Streamer) *sincResampler {
+	scale := math.Min(1, float64(to)/float64(from))
+	width := int(math.Ceil(sincTaps / scale))
+	return &sincResampler{
+		source:  source,
+		step:    float64(from) / float64(to),
+		scale:   scale,
+		width:   width,
+		end:     -1,
+		readBuf: make([][2]float64, 512),
+		// Silence before the first sample keeps the kernel in range
+		in:    make([][2]float64, width),
+		start: -width,
+	}
+}
+
+func (r *sincResampler) Stream(samples [][2]float64) (n int, ok bool) {
+	width := r.width
+	for n < len(samples) {
+		center := int(r.pos)
+		if r.end >= 0 && center >= r.end {
+			break
+		}
+		if !r.fill(center + width + 1) {
+			// The source ended; what's left is padded with silence
+			for len(r.in) < center+width+1-r.start {
+				r.in = append(r.in, [2]float64{})
+			}
+		}
+
+		var left, right, weight float64
+		for i := center - width + 1; i <= center+width; i++ {
+			x := math.Abs(r.pos-float64(i)) * r.scale * sincResolution
+			index := int(x)
+			if index >= len(sincTable)-1 {
+				continue
+			}
+			frac := x - float64(index)
+			k := sincTable[index]*(1-frac) + sincTable[index+1]*frac
+			sample := r.in[i-r.start]
+			left += sample[0] * k
+			right += sample[1] * k
+			weight += k
+		}
+		// Normalizing by the kernel sum keeps the gain exactly one
+		if weight != 0 {
+			left /= weight
+			right /= weight
+		}
+		samples[n] = [2]float64{left, right}
+		n++
+		r.pos += r.step
+
+		// Drop input no later output sample reaches
+		if drop := int(r.pos) - width - r.start; drop > 0 {
+			r.in = r.in[drop:]
+			r.start += drop
+		}
+	}
+
+	return n, n > 0
+}
+
+// fill reads input up to index until, reporting false once the source is drained
+func (r *sincResampler) fill(until int) bool {
+	for r.start+len(r.in) < until {
+		if r.end >= 0 {
+			return false
+		}
+		m, ok := r.source.Stream(r.readBuf)
+		r.in = append(r.in, r.readBuf[:m]...)
+		if !ok || m == 0 {
+			r.end = r.start + len(r.in)
+			return false
+		}
+	}
+	return true
+}
+
+func (r *sincResampler) Err() error {
+	return r.source.Err()
+}
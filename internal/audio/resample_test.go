@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/effects"
+)
+
+// sliceDecoder streams samples from memory like a decoder of a file
+type sliceDecoder struct {
+	samples [][2]float64
+	pos     int
+}
+
+func (d *sliceDecoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.pos >= len(d.samples) {
+		return 0, false
+	}
+	n = copy(samples, d.samples[d.pos:])
+	d.pos += n
+	return n, true
+}
+
+func (d *sliceDecoder) Err() error    { return nil }
+func (d *sliceDecoder) Len() int      { return len(d.samples) }
+func (d *sliceDecoder) Position() int { return d.pos }
+func (d *sliceDecoder) Close() error  { return nil }
+
+func (d *sliceDecoder) Seek(p int) error {
+	d.pos = p
+	return nil
+}
+
+// drain streams s until it ends, returning how many samples came out
+func drain(s beep.Streamer) int {
+	buf := make([][2]float64, 1000)
+	total := 0
+	for {
+		n, ok := s.Stream(buf)
+		total += n
+		if !ok {
+			return total
+		}
+	}
+}
+
+func TestTrackSeekAfterDrain(t *testing.T) {
+	for _, resampler := range []string{ResamplerSinc, ResamplerFast} {
+		t.Run(resampler, func(t *testing.T) {
+			samples := make([][2]float64, 48000)
+			for i := range samples {
+				samples[i] = [2]float64{0.5, 0.5}
+			}
+			decoder := &sliceDecoder{samples: samples}
+			track := &track{
+				decoder: decoder,
+				format:  beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 2},
+				loop:    newLooper(decoder),
+				gain:    &effects.Gain{},
+			}
+			track.setOutputRate(44100, resampler)
+
+			first := drain(track.stream)
+			if first < 44000 || first > 44200 {
+				t.Fatalf("first pass streamed %d samples, want about 44100", first)
+			}
+
+			// Played again from the start, as after the song finished
+			if err := track.seek(0); err != nil {
+				t.Fatal(err)
+			}
+			if again := drain(track.stream); again != first {
+				t.Errorf("after seeking to 0 streamed %d samples, want %d", again, first)
+			}
+
+			// Seeking halfway plays only what's after, not input left over
+			// from before the seek
+			track.seek(24000)
+			if half := drain(track.stream); half < first/2-200 || half > first/2+200 {
+				t.Errorf("after seeking halfway streamed %d samples, want about %d", half, first/2)
+			}
+		})
+	}
+}
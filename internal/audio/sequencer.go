@@ -0,0 +1,250 @@
+package audio
+
+import (
+	"math"
+	"sync"
+
+	"github.com/sammwyy/listnr/internal/library"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/effects"
+)
+
+// track is a decoded song ready to be fed to the sink
+type track struct {
+	song    *library.Song
+	decoder beep.StreamSeekCloser
+	format  beep.Format
+	stream  beep.Streamer // decoder resampled to the output rate
+	loop    *looper       // A-B loop between decoder and stream
+	gain    *effects.Gain // ReplayGain, only touched under the sink lock
+	drained bool          // reported as ended, only touched under the sink lock
+
+	// The output rate and resampler stream converts to
+	outputRate beep.SampleRate
+	resampler  string
+
+	closeOnce sync.Once
+}
+
+func openTrack(song *library.Song, sampleRate beep.SampleRate, resampler string) (*track, error) {
+	decoder, format, err := DecodeFile(song.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &track{
+		song:    song,
+		decoder: decoder,
+		format:  format,
+		loop:    newLooper(decoder),
+		gain:    &effects.Gain{},
+	}
+	if loop := song.Loop(); loop != nil {
+		t.loop.start = format.SampleRate.N(loop.Start)
+		t.loop.end = format.SampleRate.N(loop.End)
+	}
+	t.setOutputRate(sampleRate, resampler)
+	return t, nil
+}
+
+// setOutputRate resamples the track to sampleRate when it differs from the
+// track's own rate. Must be called before the track streams.
+func (t *track) setOutputRate(sampleRate beep.SampleRate, resampler string) {
+	t.outputRate, t.resampler = sampleRate, resampler
+	var stream beep.Streamer = t.loop
+	if t.format.SampleRate != sampleRate {
+		stream = newResampler(resampler, t.format.SampleRate, sampleRate, t.loop)
+	}
+	t.gain.Streamer = stream
+	t.stream = t.gain
+}
+
+// seek moves the decoder to sample pos. The resampler is rebuilt, as it
+// holds input from the old position and stays ended once the decoder was.
+func (t *track) seek(pos int) error {
+	if err := t.decoder.Seek(pos); err != nil {
+		return err
+	}
+	t.setOutputRate(t.outputRate, t.resampler)
+	return nil
+}
+
+func (t *track) Close() {
+	if t == nil {
+		return
+	}
+	t.closeOnce.Do(func() {
+		t.decoder.Close()
+	})
+}
+
+// remaining returns how many output samples are left, or -1 when the
+// decoder doesn't know its length or the track is looping
+func (t *track) remaining(sampleRate beep.SampleRate) int {
+	length := t.decoder.Len()
+	if length <= 0 || t.loop.active() {
+		return -1
+	}
+	left := length - t.decoder.Position()
+	if left < 0 {
+		left = 0
+	}
+	return int(int64(left) * int64(sampleRate) / int64(t.format.SampleRate))
+}
+
+const (
+	CurveLinear     = "linear"
+	CurveEqualPower = "equal_power"
+)
+
+// fadeGains returns the outgoing and incoming gains at progress x in [0, 1]
+func fadeGains(curve string, x float64) (out, in float64) {
+	x = clamp(x, 0, 1)
+	if curve == CurveEqualPower {
+		return math.Cos(x * math.Pi / 2), math.Sin(x * math.Pi / 2)
+	}
+	return 1 - x, x
+}
+
+// sequencer plays the current track and, when it ends, continues with the
+// next one within the same buffer so there is no gap between them. With a
+// crossfade the next track starts early while the current one fades out.
+// It never drains, producing silence while nothing is loaded.
+type sequencer struct {
+	current *track
+	next    *track
+
+	// Crossfade state; outgoing is the track fading out
+	outgoing   *track
+	fadePos    int
+	fadeLength int
+	crossfade  int // automatic crossfade in output samples, 0 for gapless
+	curve      string
+	sampleRate beep.SampleRate
+	buf        [][2]float64
+
+	// advance is called on the audio thread after switching to the next track
+	advance func(ended, started *track)
+	// release is called on the audio thread with tracks that stopped streaming
+	release func(t *track)
+	// ended is called on the audio thread, once, when the current track runs
+	// out with nothing to continue into
+	ended func(t *track)
+}
+
+func (s *sequencer) Stream(samples [][2]float64) (n int, ok bool) {
+	fadeFrom := 0
+	for n < len(samples) && s.current != nil {
+		chunk := samples[n:]
+
+		// Stop right where the crossfade into the next track has to start
+		if s.next != nil && s.crossfade > 0 && s.outgoing == nil {
+			if remaining := s.current.remaining(s.sampleRate); remaining >= 0 {
+				if remaining <= s.crossfade {
+					s.fadeInto(remaining)
+					fadeFrom = n
+					continue
+				}
+				if until := remaining - s.crossfade; until < len(chunk) {
+					chunk = chunk[:until]
+				}
+			}
+		}
+
+		m, ok := s.current.stream.Stream(chunk)
+		n += m
+		if ok && m == len(chunk) {
+			continue
+		}
+
+		if s.next == nil {
+			if !s.current.drained {
+				s.current.drained = true
+				if s.ended != nil {
+					s.ended(s.current)
+				}
+			}
+			break
+		}
+		ended := s.current
+		s.current, s.next = s.next, nil
+		s.releaseTrack(ended)
+		if s.advance != nil {
+			s.advance(ended, s.current)
+		}
+	}
+
+	for i := n; i < len(samples); i++ {
+		samples[i] = [2]float64{}
+	}
+
+	if s.outgoing != nil {
+		s.mixOutgoing(samples[fadeFrom:])
+	}
+	return len(samples), true
+}
+
+// fadeInto starts the next track, fading the current one out over length samples
+func (s *sequencer) fadeInto(length int) {
+	ended := s.current
+	s.crossfadeTo(s.next, length)
+	s.next = nil
+	if s.advance != nil {
+		s.advance(ended, s.current)
+	}
+}
+
+// crossfadeTo makes t current while the current track fades out over length samples
+func (s *sequencer) crossfadeTo(t *track, length int) {
+	if s.outgoing != nil {
+		s.releaseTrack(s.outgoing)
+	}
+	s.outgoing = s.current
+	s.current = t
+	s.fadePos = 0
+	s.fadeLength = length
+	if length <= 0 || s.outgoing == nil {
+		s.releaseTrack(s.outgoing)
+		s.outgoing = nil
+	}
+}
+
+// mixOutgoing applies the fade-in to samples and mixes in the fading out track
+func (s *sequencer) mixOutgoing(samples [][2]float64) {
+	count := s.fadeLength - s.fadePos
+	if count > len(samples) {
+		count = len(samples)
+	}
+	if cap(s.buf) < count {
+		s.buf = make([][2]float64, count)
+	}
+	buf := s.buf[:count]
+
+	m, ok := s.outgoing.stream.Stream(buf)
+	for i := m; i < count; i++ {
+		buf[i] = [2]float64{}
+	}
+
+	for i := range samples[:count] {
+		out, in := fadeGains(s.curve, float64(s.fadePos)/float64(s.fadeLength))
+		samples[i][0] = samples[i][0]*in + buf[i][0]*out
+		samples[i][1] = samples[i][1]*in + buf[i][1]*out
+		s.fadePos++
+	}
+
+	if !ok || m < count || s.fadePos >= s.fadeLength {
+		s.releaseTrack(s.outgoing)
+		s.outgoing = nil
+	}
+}
+
+func (s *sequencer) releaseTrack(t *track) {
+	if t != nil && s.release != nil {
+		s.release(t)
+	}
+}
+
+func (s *sequencer) Err() error {
+	return nil
+}
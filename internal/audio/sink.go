@@ -0,0 +1,272 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep"
+)
+
+const (
+	SinkSystem = "system" // the sound card
+	SinkWAV    = "wav"    // a WAV file, written in real time
+	SinkNull   = "null"   // discarded, for running without audio hardware
+)
+
+// Sink is an audio output. The player adds its streamer once and holds the
+// sink's lock while changing anything that streamer reads.
+type Sink interface {
+	SampleRate() beep.SampleRate
+	// SetSampleRate switches the output rate, dropping the streamers
+	// playing. It fails when CanSetSampleRate reports false.
+	SetSampleRate(sampleRate beep.SampleRate) error
+	CanSetSampleRate() bool
+	Play(s beep.Streamer)
+	Lock()
+	Unlock()
+	Close() error
+}
+
+var errSampleRateFixed = errors.New("the output sample rate can't change once playing")
+
+type SinkOptions struct {
+	Type       string
+	Device     string // system sink device from Devices, empty for the default one
+	Path       string // file written by the WAV sink
+	SampleRate beep.SampleRate
+	BufferSize time.Duration
+	// Open the system device when playback starts rather than right away,
+	// so the first song can pick the sample rate where the device can't be
+	// reopened at another one
+	Deferred bool
+}
+
+// Device is a sound card or sound server output the system sink can play to
+type Device struct {
+	Name        string // what to pass as SinkOptions.Device
+	Description string
+}
+
+func OpenSink(opts SinkOptions) (Sink, error) {
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = 44100
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = time.Second / 10
+	}
+
+	switch opts.Type {
+	case "", SinkSystem:
+		return newSystemSink(opts.Device, opts.SampleRate, opts.BufferSize, opts.Deferred)
+	case SinkWAV:
+		return newWAVSink(opts.Path, opts.SampleRate, opts.BufferSize)
+	case SinkNull:
+		return newClockSink(opts.SampleRate, opts.BufferSize, nil), nil
+	}
+	return nil, fmt.Errorf("unknown audio output %q", opts.Type)
+}
+
+// clockSink pulls audio at the pace a sound card would, handing each buffer
+// to write, or dropping it when write is nil. Nothing is written before the
+// first streamer is added.
+type clockSink struct {
+	sampleRate beep.SampleRate
+	bufferTime time.Duration
+	mixer      beep.Mixer
+	write      func(samples [][2]float64) error
+	close      func() error
+	// The sample rate can't change once written out
+	fixedOnStart bool
+	started      bool
+
+	mu   sync.Mutex
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newClockSink(sampleRate beep.SampleRate, bufferTime time.Duration, write func([][2]float64) error) *clockSink {
+	s := &clockSink{
+		sampleRate: sampleRate,
+		bufferTime: bufferTime,
+		write:      write,
+		done:       make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *clockSink) run() {
+	defer s.wg.Done()
+
+	var buf [][2]float64
+	ticker := time.NewTicker(s.bufferTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if size := s.sampleRate.N(s.bufferTime); len(buf) != size {
+			buf = make([][2]float64, size)
+		}
+		s.mixer.Stream(buf)
+		playing := s.mixer.Len() > 0
+		if playing {
+			s.started = true
+		}
+		s.mu.Unlock()
+
+		if s.write != nil && playing {
+			if err := s.write(buf); err != nil {
+				// Keep the clock running so playback still progresses
+				s.write = nil
+			}
+		}
+	}
+}
+
+func (s *clockSink) SampleRate() beep.SampleRate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sampleRate
+}
+
+func (s *clockSink) SetSampleRate(sampleRate beep.SampleRate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fixedOnStart && s.started {
+		return errSampleRateFixed
+	}
+	s.sampleRate = sampleRate
+	s.mixer.Clear()
+	return nil
+}
+
+func (s *clockSink) CanSetSampleRate() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.fixedOnStart || !s.started
+}
+
+func (s *clockSink) Play(streamer beep.Streamer) {
+	s.mu.Lock()
+	s.mixer.Add(streamer)
+	s.mu.Unlock()
+}
+
+func (s *clockSink) Lock() {
+	s.mu.Lock()
+}
+
+func (s *clockSink) Unlock() {
+	s.mu.Unlock()
+}
+
+func (s *clockSink) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	s.wg.Wait()
+
+	if s.close != nil {
+		return s.close()
+	}
+	return nil
+}
+
+// wavHeaderSize is the size of a canonical 16-bit PCM WAV header
+const wavHeaderSize = 44
+
+func newWAVSink(path string, sampleRate beep.SampleRate, bufferSize time.Duration) (*clockSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the wav output needs a file path")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wavWriter{file: file, sampleRate: sampleRate}
+	if err := w.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s := newClockSink(sampleRate, bufferSize, w.write)
+	s.fixedOnStart = true
+	s.close = func() error {
+		// The rate may have changed before anything was written
+		w.sampleRate = s.sampleRate
+		return w.close()
+	}
+	return s, nil
+}
+
+// wavWriter writes 16-bit stereo PCM, filling in the sizes on close
+type wavWriter struct {
+	file       *os.File
+	sampleRate beep.SampleRate
+	dataSize   uint32
+	buf        []byte
+}
+
+func (w *wavWriter) writeHeader() error {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+w.dataSize)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)                       // fmt chunk size
+	binary.LittleEndian.PutUint16(header[20:], 1)                        // PCM
+	binary.LittleEndian.PutUint16(header[22:], 2)                        // channels
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.sampleRate))     // sample rate
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.sampleRate)*2*2) // byte rate
+	binary.LittleEndian.PutUint16(header[32:], 2*2)                      // block align
+	binary.LittleEndian.PutUint16(header[34:], 16)                       // bits per sample
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], w.dataSize)
+
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
+
+func (w *wavWriter) write(samples [][2]float64) error {
+	if cap(w.buf) < len(samples)*4 {
+		w.buf = make([]byte, len(samples)*4)
+	}
+	buf := w.buf[:len(samples)*4]
+
+	for i, sample := range samples {
+		for c := range sample {
+			value := int16(math.Round(clamp(sample[c], -1, 1) * math.MaxInt16))
+			binary.LittleEndian.PutUint16(buf[i*4+c*2:], uint16(value))
+		}
+	}
+
+	if _, err := w.file.WriteAt(buf, int64(wavHeaderSize+w.dataSize)); err != nil {
+		return err
+	}
+	w.dataSize += uint32(len(buf))
+	return nil
+}
+
+func (w *wavWriter) close() error {
+	err := w.writeHeader()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+//go:build linux
+
+package audio
+
+// #cgo pkg-config: alsa
+//
+// #include <alsa/asoundlib.h>
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/gopxl/beep"
+)
+
+// systemSink plays through ALSA, which PulseAudio and PipeWire serve too.
+// Unlike the speaker package it can close the device and open it again, so
+// the sample rate can change with every song.
+type systemSink struct {
+	device     string
+	sampleRate beep.SampleRate
+	bufferSize time.Duration
+	pcm        *C.snd_pcm_t
+
+	// done stops the goroutine writing to pcm, which is closed once it has
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// Guards the mixer, and so what its streamers read
+	mu    sync.Mutex
+	mixer beep.Mixer
+}
+
+// newSystemSink opens device, an ALSA PCM name as listed by Devices, or
+// "default" when empty. The device is opened right away even when deferred,
+// as it can be reopened at the rate of the first song.
+func newSystemSink(device string, sampleRate beep.SampleRate, bufferSize time.Duration, deferred bool) (*systemSink, error) {
+	if device == "" {
+		device = "default"
+	}
+
+	s := &systemSink{device: device, sampleRate: sampleRate, bufferSize: bufferSize}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Devices lists the ALSA playback devices, PulseAudio and PipeWire ones
+// included where their ALSA plugins are installed
+func Devices() ([]Device, error) {
+	iface := C.CString("pcm")
+	defer C.free(unsafe.Pointer(iface))
+
+	var hints *unsafe.Pointer
+	if code := C.snd_device_name_hint(-1, iface, &hints); code < 0 {
+		return nil, alsaError("listing audio devices", code)
+	}
+	defer C.snd_device_name_free_hint(hints)
+
+	hint := func(h unsafe.Pointer, id string) string {
+		name := C.CString(id)
+		defer C.free(unsafe.Pointer(name))
+		value := C.snd_device_name_get_hint(h, name)
+		if value == nil {
+			return ""
+		}
+		defer C.free(unsafe.Pointer(value))
+		return C.GoString(value)
+	}
+
+	var devices []Device
+	for ; *hints != nil; hints = (*unsafe.Pointer)(unsafe.Add(unsafe.Pointer(hints), unsafe.Sizeof(*hints))) {
+		// IOID is unset for devices that play and record
+		if hint(*hints, "IOID") == "Input" {
+			continue
+		}
+		name := hint(*hints, "NAME")
+		if name == "" || name == "null" {
+			continue
+		}
+		devices = append(devices, Device{Name: name, Description: hint(*hints, "DESC")})
+	}
+	return devices, nil
+}
+
+func alsaError(action string, code C.int) error {
+	return fmt.Errorf("%s: %s", action, C.GoString(C.snd_strerror(code)))
+}
+
+// open opens the device at the sink's sample rate and starts writing to it
+func (s *systemSink) open() error {
+	name := C.CString(s.device)
+	defer C.free(unsafe.Pointer(name))
+
+	var pcm *C.snd_pcm_t
+	if code := C.snd_pcm_open(&pcm, name, C.SND_PCM_STREAM_PLAYBACK, 0); code < 0 {
+		// Unknown names fail here rather than playing somewhere else
+		return alsaError(fmt.Sprintf("opening audio device %q (see listnr devices)", s.device), code)
+	}
+	// ALSA converts the rate itself when the hardware doesn't support it
+	code := C.snd_pcm_set_params(pcm, C.SND_PCM_FORMAT_FLOAT_LE, C.SND_PCM_ACCESS_RW_INTERLEAVED,
+		2, C.uint(s.sampleRate), 1, C.uint(s.bufferSize.Microseconds()))
+	if code < 0 {
+		C.snd_pcm_close(pcm)
+		return alsaError(fmt.Sprintf("setting up audio device %q at %d Hz", s.device, s.sampleRate), code)
+	}
+
+	s.pcm = pcm
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go s.run(pcm, s.sampleRate.N(s.bufferSize/2), s.done)
+	return nil
+}
+
+// close stops writing and closes the device, dropping what it still buffers
+func (s *systemSink) close() {
+	if s.pcm == nil {
+		return
+	}
+	close(s.done)
+	s.wg.Wait()
+	C.snd_pcm_drop(s.pcm)
+	C.snd_pcm_close(s.pcm)
+	s.pcm = nil
+}
+
+// run mixes the streamers into pcm in chunks of frames until done. The
+// device blocks each write until there is room, which paces the mixing.
+func (s *systemSink) run(pcm *C.snd_pcm_t, frames int, done <-chan struct{}) {
+	defer s.wg.Done()
+
+	if frames < 1 {
+		frames = 1
+	}
+	buf := make([][2]float64, frames)
+	out := make([]float32, frames*2)
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		s.mu.Lock()
+		s.mixer.Stream(buf)
+		s.mu.Unlock()
+
+		for i, sample := range buf {
+			out[i*2] = float32(sample[0])
+			out[i*2+1] = float32(sample[1])
+		}
+
+		for written := 0; written < frames; {
+			n := C.snd_pcm_writei(pcm, unsafe.Pointer(&out[written*2]), C.snd_pcm_uframes_t(frames-written))
+			if n < 0 {
+				// Underruns and suspends can be recovered from, a device
+				// that went away can't
+				if C.snd_pcm_recover(pcm, C.int(n), 1) < 0 {
+					<-done
+					return
+				}
+				continue
+			}
+			written += int(n)
+		}
+	}
+}
+
+func (s *systemSink) SampleRate() beep.SampleRate {
+	return s.sampleRate
+}
+
+func (s *systemSink) SetSampleRate(sampleRate beep.SampleRate) error {
+	if sampleRate == s.sampleRate && s.pcm != nil {
+		return nil
+	}
+
+	s.close()
+	s.mu.Lock()
+	s.mixer.Clear()
+	s.mu.Unlock()
+
+	previous := s.sampleRate
+	s.sampleRate = sampleRate
+	if err := s.open(); err != nil {
+		// Keep playing at the old rate rather than not at all
+		s.sampleRate = previous
+		s.open()
+		return err
+	}
+	return nil
+}
+
+func (s *systemSink) CanSetSampleRate() bool {
+	return true
+}
+
+func (s *systemSink) Play(streamer beep.Streamer) {
+	s.mu.Lock()
+	s.mixer.Add(streamer)
+	s.mu.Unlock()
+}
+
+func (s *systemSink) Lock() {
+	s.mu.Lock()
+}
+
+func (s *systemSink) Unlock() {
+	s.mu.Unlock()
+}
+
+func (s *systemSink) Close() error {
+	s.close()
+	return nil
+}
@@ -0,0 +1,90 @@
+//go:build !linux
+
+package audio
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/speaker"
+)
+
+var errDeviceChoice = errors.New("choosing an audio device is only supported on Linux")
+
+// Devices lists the devices the system sink can play to
+func Devices() ([]Device, error) {
+	return nil, errDeviceChoice
+}
+
+// systemSink plays through the speaker package. The audio driver can only
+// be set up once per process, so the sample rate is fixed from then on.
+type systemSink struct {
+	sampleRate  beep.SampleRate
+	bufferSize  time.Duration
+	initialized bool
+}
+
+func newSystemSink(device string, sampleRate beep.SampleRate, bufferSize time.Duration, deferred bool) (*systemSink, error) {
+	// The driver always opens the default device
+	if device != "" {
+		return nil, errDeviceChoice
+	}
+
+	s := &systemSink{sampleRate: sampleRate, bufferSize: bufferSize}
+	if !deferred {
+		if err := s.init(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *systemSink) init() error {
+	if err := speaker.Init(s.sampleRate, s.sampleRate.N(s.bufferSize)); err != nil {
+		return err
+	}
+	s.initialized = true
+	return nil
+}
+
+func (s *systemSink) SampleRate() beep.SampleRate {
+	return s.sampleRate
+}
+
+func (s *systemSink) SetSampleRate(sampleRate beep.SampleRate) error {
+	if s.initialized {
+		if sampleRate == s.sampleRate {
+			return nil
+		}
+		return errSampleRateFixed
+	}
+	s.sampleRate = sampleRate
+	return s.init()
+}
+
+func (s *systemSink) CanSetSampleRate() bool {
+	return !s.initialized
+}
+
+func (s *systemSink) Play(streamer beep.Streamer) {
+	if !s.initialized && s.init() != nil {
+		return
+	}
+	speaker.Play(streamer)
+}
+
+func (s *systemSink) Lock() {
+	speaker.Lock()
+}
+
+func (s *systemSink) Unlock() {
+	speaker.Unlock()
+}
+
+func (s *systemSink) Close() error {
+	if s.initialized {
+		speaker.Close()
+	}
+	return nil
+}
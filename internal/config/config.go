@@ -1,19 +1,129 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 )
 
+type RepeatMode string
+
+const (
+	RepeatOff RepeatMode = "off"
+	RepeatOne RepeatMode = "one"
+	RepeatAll RepeatMode = "all"
+)
+
+// Next returns the mode following m in the toggle cycle
+func (m RepeatMode) Next() RepeatMode {
+	switch m {
+	case RepeatAll:
+		return RepeatOne
+	case RepeatOne:
+		return RepeatOff
+	default:
+		return RepeatAll
+	}
+}
+
+// UnmarshalJSON also accepts the boolean repeat_mode of older configs,
+// where true meant repeating the current song
+func (m *RepeatMode) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*m = RepeatOff
+		if enabled {
+			*m = RepeatOne
+		}
+		return nil
+	}
+
+	var mode string
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return err
+	}
+	switch RepeatMode(mode) {
+	case RepeatOne, RepeatAll:
+		*m = RepeatMode(mode)
+	default:
+		*m = RepeatOff
+	}
+	return nil
+}
+
 type Config struct {
-	MusicRoutes     []string `json:"music_routes"`
-	Volume          float64  `json:"volume"`
-	LastPath        string   `json:"last_path"`
-	AutoplayEnabled bool     `json:"autoplay_enabled"`
-	RepeatMode      bool     `json:"repeat_mode"`
+	MusicRoutes     []string   `json:"music_routes"`
+	Volume          float64    `json:"volume"`
+	LastPath        string     `json:"last_path"`
+	AutoplayEnabled bool       `json:"autoplay_enabled"`
+	SkipUnplayable  bool       `json:"skip_unplayable"` // in autoplay, move past songs that fail to play
+	ResumePlayback  bool       `json:"resume_playback"` // cue the last song at its position on launch
+	RepeatMode      RepeatMode `json:"repeat_mode"`
+	VisualizerBands int        `json:"visualizer_bands"`
+	ShuffleMode     string     `json:"shuffle_mode"` // off, track, album or weighted
+
+	// Crossfade durations in seconds, 0 for gapless transitions
+	CrossfadeSeconds       float64 `json:"crossfade_seconds"`
+	ManualCrossfadeSeconds float64 `json:"manual_crossfade_seconds"`
+	CrossfadeCurve         string  `json:"crossfade_curve"` // linear or equal_power
+
+	ReplayGainMode   string  `json:"replaygain_mode"`   // off, track, album or auto
+	ReplayGainPreamp float64 `json:"replaygain_preamp"` // dB added to the tagged gain
+
+	// Equalizer gains in dB per band, the preset they came from and
+	// user-defined presets by name
+	Equalizer        string               `json:"equalizer"`
+	EqualizerGains   []float64            `json:"equalizer_gains"`
+	EqualizerPresets map[string][]float64 `json:"equalizer_presets,omitempty"`
+
+	// Gain in dB at the lowest and highest volume levels
+	VolumeMinDecibels float64 `json:"volume_min_db"`
+	VolumeMaxDecibels float64 `json:"volume_max_db"`
+
+	// Audio output: system, wav or null. The device, an ALSA device name,
+	// applies to the system output, the path to the wav output.
+	Output       string `json:"output"`
+	OutputDevice string `json:"output_device"`
+	OutputPath   string `json:"output_path"`
+	SampleRate   int    `json:"sample_rate"`
+	BufferMillis int    `json:"buffer_ms"`
+
+	// Play songs at their own sample rate where the output allows it, and
+	// how to convert them otherwise: sinc (best) or fast
+	NativeSampleRate bool   `json:"native_sample_rate"`
+	Resampler        string `json:"resampler"`
+
+	// Songs at least this long, e.g. audiobooks, resume where they were
+	// left. 0 turns it off.
+	ResumeMinMinutes float64 `json:"resume_min_minutes"`
+
+	PlaybackRate float64 `json:"playback_rate"` // 0.5 to 3
+	RateMode     string  `json:"rate_mode"`     // tape or stretch (pitch preserved)
+
+	// Measure EBU R128 loudness of untagged songs while the player runs
+	AnalyzeInBackground bool `json:"analyze_in_background"`
+}
+
+// ResumeMinDuration returns the shortest song resume positions are kept for,
+// 0 when they are not
+func (c *Config) ResumeMinDuration() time.Duration {
+	if c.ResumeMinMinutes <= 0 {
+		return 0
+	}
+	return time.Duration(c.ResumeMinMinutes * float64(time.Minute))
+}
+
+// Path returns the location of the configuration file
+func Path() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(usr.HomeDir, ".config", "listnr.json"), nil
 }
 
 func Load() (*Config, error) {
@@ -22,16 +132,35 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	configPath := filepath.Join(usr.HomeDir, ".config", "listnr.json")
+	configPath, err := Path()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create default config if it doesn't exist
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		defaultConfig := &Config{
-			MusicRoutes:     []string{filepath.Join(usr.HomeDir, "Music")},
-			Volume:          0.5,
-			LastPath:        "",
-			AutoplayEnabled: true,
-			RepeatMode:      false,
+			MusicRoutes:       []string{filepath.Join(usr.HomeDir, "Music")},
+			Volume:            0.5,
+			LastPath:          "",
+			AutoplayEnabled:   true,
+			SkipUnplayable:    true,
+			ResumePlayback:    true,
+			ResumeMinMinutes:  20,
+			RepeatMode:        RepeatOff,
+			VisualizerBands:   16,
+			ShuffleMode:       "off",
+			CrossfadeCurve:    "equal_power",
+			ReplayGainMode:    "auto",
+			Equalizer:         "flat",
+			VolumeMinDecibels: -50,
+			VolumeMaxDecibels: 0,
+			Output:            "system",
+			SampleRate:        44100,
+			BufferMillis:      100,
+			Resampler:         "sinc",
+			PlaybackRate:      1,
+			RateMode:          "stretch",
 		}
 
 		// Create .config directory if it doesn't exist
@@ -61,10 +190,50 @@ func Load() (*Config, error) {
 	return &config, nil
 }
 
+// Update applies change to the configuration file as stored, so settings
+// overridden for a single run (e.g. by flags) or edited by hand meanwhile
+// are kept
+func Update(change func(cfg *Config)) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+
+	var cfg Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	before, err := json.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	change(&cfg)
+	after, err := json.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) {
+		// Nothing changed, leave the file alone
+		return nil
+	}
+	return Save(&cfg, path)
+}
+
 func Save(cfg *Config, path string) error {
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, data, 0644)
+
+	// Write atomically so a crash mid-save never leaves a truncated config
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Session is the playback state saved on exit and restored on launch
+type Session struct {
+	Song     string        `json:"song,omitempty"` // path of the loaded song
+	Position time.Duration `json:"position,omitempty"`
+	Queue    []string      `json:"queue,omitempty"`
+	Original []string      `json:"original,omitempty"` // unshuffled queue order while shuffling
+	Current  int           `json:"current"`            // queue index of the playing song, -1 for none
+}
+
+// DataDir returns listnr's directory under the XDG data directory, for what
+// isn't a cache and must survive cleaning one
+func DataDir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataDir, "listnr"), nil
+}
+
+// SessionPath returns the session location under the XDG data directory
+func SessionPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "session.json"), nil
+}
+
+// oldSessionPath is where sessions were kept before, in the cache directory
+func oldSessionPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "listnr", "session.json"), nil
+}
+
+// LoadSession reads the saved session. A missing or unreadable session
+// yields an empty one.
+func LoadSession() *Session {
+	session := &Session{Current: -1}
+
+	path, err := SessionPath()
+	if err != nil {
+		return session
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Carry over a session saved by an older version
+		if old, oldErr := oldSessionPath(); oldErr == nil {
+			data, err = os.ReadFile(old)
+		}
+	}
+	if err != nil {
+		return session
+	}
+	if err := json.Unmarshal(data, session); err != nil {
+		return &Session{Current: -1}
+	}
+	return session
+}
+
+func SaveSession(session *Session) error {
+	path, err := SessionPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write atomically so a crash mid-save never loses the previous session
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
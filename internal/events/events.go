@@ -15,8 +15,13 @@ const (
 	PlaybackResumed  EventType = "playback_resumed"
 	SongEnded        EventType = "song_ended"
 	ProgressUpdated  EventType = "progress_updated"
+	Seeked           EventType = "seeked"
 	VolumeChanged    EventType = "volume_changed"
+	RateChanged      EventType = "rate_changed"
+	LoopChanged      EventType = "loop_changed"
 	AudioDataUpdated EventType = "audio_data_updated"
+	LibraryChanged   EventType = "library_changed"
+	PlaybackError    EventType = "playback_error"
 )
 
 type Event struct {
@@ -38,12 +43,43 @@ type ProgressData struct {
 	Song    *library.Song
 }
 
+type SeekData struct {
+	Song     *library.Song
+	Position time.Duration
+}
+
 type VolumeData struct {
 	Level float64
+	Muted bool
+}
+
+type RateData struct {
+	Rate float64
+	Mode string
+}
+
+type LoopData struct {
+	Song  *library.Song
+	Start time.Duration // point A, -1 when unset
+	End   time.Duration // point B, -1 when unset
 }
 
 type SongEndedData struct {
 	Song *library.Song
+	Next *library.Song // set when playback already continued gaplessly into Next
+}
+
+type ErrorKind string
+
+const (
+	ErrorDecode   ErrorKind = "decode"   // the file couldn't be opened or decoded
+	ErrorPlayback ErrorKind = "playback" // decoding failed partway through
+)
+
+type ErrorData struct {
+	Kind ErrorKind
+	Song *library.Song
+	Err  error
 }
 
 type AudioData struct {
@@ -52,6 +88,10 @@ type AudioData struct {
 	IsPlaying      bool
 }
 
+type LibraryChangedData struct {
+	Directories []string
+}
+
 type EventBus struct {
 	subscribers map[EventType][]chan Event
 	mu          sync.RWMutex
@@ -0,0 +1,163 @@
+package ipc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// ServiceName prefixes the methods on the socket, e.g. "Listnr.Next"
+const ServiceName = "Listnr"
+
+var ErrAlreadyRunning = errors.New("another listnr is already listening on the control socket")
+
+// SocketPath returns the control socket location, in a directory of its own
+// under XDG_RUNTIME_DIR when set, otherwise in the temporary directory
+func SocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "listnr", "listnr.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("listnr-%d", os.Getuid()), "listnr.sock")
+}
+
+// privateDir creates dir accessible only by the user, or checks that an
+// existing one is. Other users could otherwise connect to the socket, or
+// plant their own at a predictable path in a shared directory.
+func privateDir(dir string, create bool) error {
+	if create {
+		if err := os.Mkdir(dir, 0700); err == nil || !os.IsExist(err) {
+			return err
+		}
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	switch {
+	case !info.IsDir():
+		return fmt.Errorf("%s is not a directory", dir)
+	case !ok || int(stat.Uid) != os.Getuid():
+		return fmt.Errorf("%s is not owned by the current user", dir)
+	case info.Mode().Perm()&0077 != 0:
+		return fmt.Errorf("%s is accessible by other users", dir)
+	}
+	return nil
+}
+
+// checkSocket refuses a path that isn't a socket of the current user
+func checkSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if info.Mode()&os.ModeSocket == 0 || !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not a socket of the current user", path)
+	}
+	return nil
+}
+
+// Server serves the control API as JSON-RPC on a Unix socket
+type Server struct {
+	listener net.Listener
+	rpc      *rpc.Server
+	path     string
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// Listen opens the socket at path, creating its directory accessible only
+// by the user. A socket left behind by a crashed run is replaced, a live one
+// is not.
+func Listen(path string, service *Service) (*Server, error) {
+	if err := privateDir(filepath.Dir(path), true); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		if err := checkSocket(path); err != nil {
+			return nil, err
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, ErrAlreadyRunning
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, service); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		listener: listener,
+		rpc:      server,
+		path:     path,
+		conns:    make(map[net.Conn]bool),
+	}, nil
+}
+
+// Serve handles clients until Close is called
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		go func() {
+			s.rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops listening, disconnects clients and removes the socket
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	os.Remove(s.path)
+	return err
+}
+
+// Dial connects to the control socket of a running listnr, refusing one
+// that another user could have put in place
+func Dial(path string) (*rpc.Client, error) {
+	if err := privateDir(filepath.Dir(path), false); err != nil {
+		return nil, err
+	}
+	if err := checkSocket(path); err != nil {
+		return nil, err
+	}
+	return jsonrpc.Dial("unix", path)
+}
@@ -0,0 +1,218 @@
+package ipc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sammwyy/listnr/internal/audio"
+	"github.com/sammwyy/listnr/internal/library"
+	"github.com/sammwyy/listnr/internal/ui"
+)
+
+var errStopped = errors.New("listnr is shutting down")
+
+// Empty is the argument or reply of methods that take or return nothing
+type Empty struct{}
+
+// SongInfo describes a song. Durations are in seconds.
+type SongInfo struct {
+	Path     string  `json:"path"`
+	Title    string  `json:"title"`
+	Artist   string  `json:"artist,omitempty"`
+	Album    string  `json:"album,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+type Status struct {
+	State       string    `json:"state"` // playing, paused or stopped
+	Song        *SongInfo `json:"song,omitempty"`
+	Position    float64   `json:"position"` // seconds
+	Duration    float64   `json:"duration"` // seconds
+	Volume      float64   `json:"volume"`   // 0 to 1
+	Muted       bool      `json:"muted"`
+	Rate        float64   `json:"rate"`
+	QueueIndex  int       `json:"queue_index"` // -1 when not playing from the queue
+	QueueLength int       `json:"queue_length"`
+}
+
+type SeekArgs struct {
+	Position float64 `json:"position"` // seconds
+	Relative bool    `json:"relative"` // from the current position
+}
+
+type VolumeArgs struct {
+	Level    float64 `json:"level"` // 0 to 1
+	Relative bool    `json:"relative"`
+}
+
+type QueueReply struct {
+	Songs   []SongInfo `json:"songs"`
+	Current int        `json:"current"`
+}
+
+type EnqueueArgs struct {
+	Paths []string `json:"paths"` // absolute paths of library songs
+	Next  bool     `json:"next"`  // play after the current song
+}
+
+// Service is the control API. Its methods follow net/rpc conventions and run
+// on connection goroutines, so anything touching the UI is queued to it.
+type Service struct {
+	player  *audio.Player
+	app     *ui.App
+	library *library.Library
+}
+
+func NewService(player *audio.Player, app *ui.App, lib *library.Library) *Service {
+	return &Service{player: player, app: app, library: lib}
+}
+
+func (s *Service) Status(_ Empty, reply *Status) error {
+	song := s.player.CurrentSong()
+	queue := s.app.Queue()
+	rate, _ := s.player.Rate()
+
+	*reply = Status{
+		State:       "stopped",
+		Volume:      s.player.Volume(),
+		Muted:       s.player.Muted(),
+		Rate:        rate,
+		QueueIndex:  queue.CurrentIndex(),
+		QueueLength: queue.Len(),
+	}
+	if song != nil {
+		reply.State = "paused"
+		if s.player.IsPlaying() {
+			reply.State = "playing"
+		}
+		info := songInfo(song)
+		reply.Song = &info
+		reply.Position = s.player.Position().Seconds()
+		reply.Duration = s.player.Duration().Seconds()
+	}
+	return nil
+}
+
+func (s *Service) Play(_ Empty, _ *Empty) error {
+	s.player.SetPaused(false)
+	return nil
+}
+
+func (s *Service) Pause(_ Empty, _ *Empty) error {
+	s.player.SetPaused(true)
+	return nil
+}
+
+func (s *Service) Toggle(_ Empty, _ *Empty) error {
+	s.player.TogglePlayPause()
+	return nil
+}
+
+func (s *Service) Stop(_ Empty, _ *Empty) error {
+	s.player.Stop()
+	return nil
+}
+
+func (s *Service) Next(_ Empty, _ *Empty) error {
+	if !s.app.QueueUpdateDraw(s.app.NextSong) {
+		return errStopped
+	}
+	return nil
+}
+
+func (s *Service) Previous(_ Empty, _ *Empty) error {
+	if !s.app.QueueUpdateDraw(s.app.PreviousSong) {
+		return errStopped
+	}
+	return nil
+}
+
+func (s *Service) Seek(args SeekArgs, _ *Empty) error {
+	position := args.Position
+	if args.Relative {
+		position += s.player.Position().Seconds()
+	}
+	s.player.SeekTo(time.Duration(position * float64(time.Second)))
+	return nil
+}
+
+func (s *Service) Volume(args VolumeArgs, _ *Empty) error {
+	level := args.Level
+	if args.Relative {
+		level += s.player.Volume()
+	}
+	s.player.SetVolume(level)
+	return nil
+}
+
+func (s *Service) Mute(_ Empty, _ *Empty) error {
+	s.player.ToggleMute()
+	return nil
+}
+
+func (s *Service) Queue(_ Empty, reply *QueueReply) error {
+	queue := s.app.Queue()
+	songs := queue.Songs()
+
+	reply.Songs = make([]SongInfo, len(songs))
+	for i, song := range songs {
+		reply.Songs[i] = songInfo(song)
+	}
+	reply.Current = queue.CurrentIndex()
+	return nil
+}
+
+// Enqueue adds songs by path, failing without adding any if one isn't in
+// the library. The reply is the number of songs added.
+func (s *Service) Enqueue(args EnqueueArgs, reply *int) error {
+	songs := make([]*library.Song, 0, len(args.Paths))
+	for _, path := range args.Paths {
+		song, _ := s.library.FindSong(path)
+		if song == nil {
+			return fmt.Errorf("%s is not in the library", path)
+		}
+		songs = append(songs, song)
+	}
+
+	queued := s.app.QueueUpdateDraw(func() {
+		s.app.Enqueue(songs, args.Next)
+	})
+	if !queued {
+		return errStopped
+	}
+	*reply = len(songs)
+	return nil
+}
+
+// Jump plays the queue entry at index
+func (s *Service) Jump(index int, _ *Empty) error {
+	var played bool
+	ran := s.app.QueueUpdateDraw(func() {
+		played = s.app.PlayQueueEntry(index)
+	})
+	if !ran {
+		return errStopped
+	}
+	if !played {
+		return fmt.Errorf("no queue entry %d", index)
+	}
+	return nil
+}
+
+func (s *Service) Clear(_ Empty, _ *Empty) error {
+	if !s.app.QueueUpdateDraw(s.app.ClearQueue) {
+		return errStopped
+	}
+	return nil
+}
+
+func songInfo(song *library.Song) SongInfo {
+	return SongInfo{
+		Path:     song.Path,
+		Title:    song.DisplayName(),
+		Artist:   song.Artist,
+		Album:    song.Album,
+		Duration: song.Duration.Seconds(),
+	}
+}
@@ -0,0 +1,459 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+var id3v2Frames = map[string]string{
+	"TIT2": tagTitle, "TT2": tagTitle,
+	"TPE1": tagArtist, "TP1": tagArtist,
+	"TALB": tagAlbum, "TAL": tagAlbum,
+	"TPE2": tagAlbumArtist, "TP2": tagAlbumArtist,
+	"TRCK": tagTrack, "TRK": tagTrack,
+	"TPOS": tagDisc, "TPA": tagDisc,
+	"TDRC": tagDate, "TYER": tagDate, "TYE": tagDate, "TDRL": tagDate,
+	"TCON": tagGenre, "TCO": tagGenre,
+}
+
+func readMP3(r io.ReaderAt, size int64, meta *metadata) error {
+	audioStart, err := readID3v2(r, 0, meta)
+	if err != nil {
+		return err
+	}
+
+	audioEnd := size
+	if hasID3v1(r, size) {
+		readID3v1(r, size, meta)
+		audioEnd -= 128
+	}
+
+	if meta.duration == 0 {
+		meta.duration = mp3Duration(r, audioStart, audioEnd)
+	}
+
+	return nil
+}
+
+// readID3v2 parses an ID3v2 tag at offset and returns the offset just past it
+func readID3v2(r io.ReaderAt, offset int64, meta *metadata) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, offset); err != nil || string(header[:3]) != "ID3" {
+		return offset, nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	tagSize := int64(syncsafe(header[6:10]))
+	end := offset + 10 + tagSize
+	if flags&0x10 != 0 { // footer present
+		end += 10
+	}
+
+	if version < 2 || version > 4 {
+		return end, nil
+	}
+
+	data := make([]byte, tagSize)
+	if _, err := r.ReadAt(data, offset+10); err != nil {
+		return end, err
+	}
+
+	if flags&0x80 != 0 && version < 4 {
+		data = removeUnsync(data)
+	}
+
+	// Skip the extended header
+	if flags&0x40 != 0 && len(data) >= 4 {
+		extSize := int(binary.BigEndian.Uint32(data[:4]))
+		if version == 4 {
+			extSize = syncsafe(data[:4])
+		} else {
+			extSize += 4
+		}
+		if extSize > len(data) {
+			return end, errors.New("id3: invalid extended header")
+		}
+		data = data[extSize:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(data) >= headerLen && data[0] != 0 {
+		id := string(data[:idLen])
+		var frameSize int
+		var frameFlags uint16
+
+		switch version {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(data[4:8]))
+			frameFlags = binary.BigEndian.Uint16(data[8:10])
+		case 4:
+			frameSize = syncsafe(data[4:8])
+			frameFlags = binary.BigEndian.Uint16(data[8:10])
+		}
+
+		if frameSize <= 0 || headerLen+frameSize > len(data) {
+			break
+		}
+		body := data[headerLen : headerLen+frameSize]
+		data = data[headerLen+frameSize:]
+
+		if version == 4 {
+			if frameFlags&0x000C != 0 { // compressed or encrypted
+				continue
+			}
+			if frameFlags&0x0001 != 0 && len(body) >= 4 { // data length indicator
+				body = body[4:]
+			}
+			if frameFlags&0x0002 != 0 {
+				body = removeUnsync(body)
+			}
+		} else if version == 3 && frameFlags&0x00C0 != 0 {
+			continue
+		}
+
+		readID3Frame(id, body, meta)
+	}
+
+	return end, nil
+}
+
+func readID3Frame(id string, body []byte, meta *metadata) {
+	switch {
+	case id == "TXXX" || id == "TXX":
+		if len(body) < 2 {
+			return
+		}
+		parts := splitID3Strings(body[0], body[1:])
+		if len(parts) >= 2 {
+			meta.set(parts[0], parts[1])
+		}
+	case id == "POPM" || id == "POP":
+		// Popularimeter: email, then a 0-255 rating and an optional play counter
+		if i := bytes.IndexByte(body, 0); i >= 0 && i+1 < len(body) {
+			if stars := popmStars(body[i+1]); stars > 0 {
+				meta.set(tagRating, strconv.Itoa(stars))
+			}
+		}
+	case id == "TLEN" || id == "TLE":
+		if ms, err := strconv.Atoi(strings.TrimSpace(decodeID3Text(body))); err == nil && ms > 0 {
+			meta.duration = time.Duration(ms) * time.Millisecond
+		}
+	case id3v2Frames[id] != "":
+		value := decodeID3Text(body)
+		if id3v2Frames[id] == tagGenre {
+			value = resolveID3Genre(value)
+		}
+		meta.set(id3v2Frames[id], value)
+	}
+}
+
+// popmStars maps a popularimeter rating onto 1-5 stars, using the
+// thresholds that match the values written by common players
+func popmStars(rating byte) int {
+	switch {
+	case rating == 0:
+		return 0
+	case rating < 32:
+		return 1
+	case rating < 96:
+		return 2
+	case rating < 160:
+		return 3
+	case rating < 224:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// decodeID3Text decodes a text frame body, keeping only the first value
+func decodeID3Text(body []byte) string {
+	if len(body) < 1 {
+		return ""
+	}
+	parts := splitID3Strings(body[0], body[1:])
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+func splitID3Strings(encoding byte, data []byte) []string {
+	var parts []string
+
+	switch encoding {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		for len(data) >= 2 {
+			end := len(data)
+			for i := 0; i+1 < len(data); i += 2 {
+				if data[i] == 0 && data[i+1] == 0 {
+					end = i
+					break
+				}
+			}
+			parts = append(parts, decodeUTF16(data[:end], encoding == 2))
+			if end+2 > len(data) {
+				break
+			}
+			data = data[end+2:]
+		}
+	case 3: // UTF-8
+		for _, part := range bytes.Split(data, []byte{0}) {
+			parts = append(parts, string(part))
+		}
+	default: // ISO-8859-1
+		for _, part := range bytes.Split(data, []byte{0}) {
+			parts = append(parts, latin1(part))
+		}
+	}
+
+	return parts
+}
+
+func decodeUTF16(data []byte, bigEndian bool) string {
+	if len(data) >= 2 {
+		switch {
+		case data[0] == 0xFF && data[1] == 0xFE:
+			bigEndian = false
+			data = data[2:]
+		case data[0] == 0xFE && data[1] == 0xFF:
+			bigEndian = true
+			data = data[2:]
+		}
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(data[i*2:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func removeUnsync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xFF && i+1 < len(data) && data[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+// resolveID3Genre turns "(17)", "17" or "(17)Rock" into a genre name
+func resolveID3Genre(value string) string {
+	if strings.HasPrefix(value, "(") {
+		if end := strings.IndexByte(value, ')'); end > 0 {
+			if rest := value[end+1:]; rest != "" {
+				return rest
+			}
+			value = value[1:end]
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		if n >= 0 && n < len(id3Genres) {
+			return id3Genres[n]
+		}
+		return ""
+	}
+	return value
+}
+
+func hasID3v1(r io.ReaderAt, size int64) bool {
+	if size < 128 {
+		return false
+	}
+	marker := make([]byte, 3)
+	_, err := r.ReadAt(marker, size-128)
+	return err == nil && string(marker) == "TAG"
+}
+
+func readID3v1(r io.ReaderAt, size int64, meta *metadata) {
+	tag := make([]byte, 128)
+	if _, err := r.ReadAt(tag, size-128); err != nil {
+		return
+	}
+
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return latin1(b)
+	}
+
+	meta.set(tagTitle, field(tag[3:33]))
+	meta.set(tagArtist, field(tag[33:63]))
+	meta.set(tagAlbum, field(tag[63:93]))
+	meta.set(tagDate, field(tag[93:97]))
+
+	// ID3v1.1 stores the track number in the last comment byte
+	if tag[125] == 0 && tag[126] != 0 {
+		meta.set(tagTrack, strconv.Itoa(int(tag[126])))
+	}
+	if int(tag[127]) < len(id3Genres) {
+		meta.set(tagGenre, id3Genres[tag[127]])
+	}
+}
+
+var mp3Bitrates = [2][3][16]int{
+	{ // MPEG 1
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{ // MPEG 2 / 2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG 2.5
+	{},                    // reserved
+	{22050, 24000, 16000}, // MPEG 2
+	{44100, 48000, 32000}, // MPEG 1
+}
+
+// mp3Duration reads the Xing/Info or VBRI header of the first frame, falling
+// back to a constant bitrate estimate
+func mp3Duration(r io.ReaderAt, start, end int64) time.Duration {
+	buf := make([]byte, 8192)
+	n, _ := r.ReadAt(buf, start)
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+
+		versionBits := (buf[i+1] >> 3) & 0x03
+		layerBits := (buf[i+1] >> 1) & 0x03
+		bitrateIndex := buf[i+2] >> 4
+		rateIndex := (buf[i+2] >> 2) & 0x03
+		if versionBits == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+
+		mpeg1 := versionBits == 3
+		layer := 4 - int(layerBits) // 1, 2 or 3
+		sampleRate := mp3SampleRates[versionBits][rateIndex]
+		table := 1
+		if mpeg1 {
+			table = 0
+		}
+		bitrate := mp3Bitrates[table][layer-1][bitrateIndex] * 1000
+		mono := buf[i+3]>>6 == 3
+
+		samplesPerFrame := 1152
+		switch {
+		case layer == 1:
+			samplesPerFrame = 384
+		case layer == 3 && !mpeg1:
+			samplesPerFrame = 576
+		}
+
+		// Xing/Info header sits right after the side information
+		sideInfo := 32
+		switch {
+		case mpeg1 && mono:
+			sideInfo = 17
+		case !mpeg1 && !mono:
+			sideInfo = 17
+		case !mpeg1 && mono:
+			sideInfo = 9
+		}
+
+		if frames := xingFrames(buf[i:], 4+sideInfo); frames > 0 {
+			return time.Duration(frames) * time.Duration(samplesPerFrame) * time.Second / time.Duration(sampleRate)
+		}
+		if frames := vbriFrames(buf[i:]); frames > 0 {
+			return time.Duration(frames) * time.Duration(samplesPerFrame) * time.Second / time.Duration(sampleRate)
+		}
+
+		audioBytes := end - (start + int64(i))
+		if bitrate > 0 && audioBytes > 0 {
+			return time.Duration(audioBytes*8) * time.Second / time.Duration(bitrate)
+		}
+		return 0
+	}
+
+	return 0
+}
+
+func xingFrames(frame []byte, offset int) int {
+	if offset+12 > len(frame) {
+		return 0
+	}
+	id := string(frame[offset : offset+4])
+	if id != "Xing" && id != "Info" {
+		return 0
+	}
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	if flags&0x01 == 0 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(frame[offset+8:]))
+}
+
+func vbriFrames(frame []byte) int {
+	const offset = 36
+	if offset+18 > len(frame) || string(frame[offset:offset+4]) != "VBRI" {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(frame[offset+14:]))
+}
+
+var id3Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion",
+	"Bebob", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde",
+	"Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony",
+	"Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul",
+	"Freestyle", "Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House",
+	"Dance Hall",
+}
@@ -0,0 +1,156 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Bump whenever Song or the tag readers change in a way that invalidates cached entries
+const indexVersion = 4
+
+type indexEntry struct {
+	ModTime  int64     `json:"mtime"`
+	Size     int64     `json:"size"`
+	Song     *Song     `json:"song"`
+	Loudness *Loudness `json:"loudness,omitempty"`
+}
+
+// Index is an on-disk cache of scanned songs keyed by path, so rescans only
+// re-read files whose modification time or size changed
+type Index struct {
+	Version int                    `json:"version"`
+	Entries map[string]*indexEntry `json:"entries"`
+
+	path string
+	seen map[string]bool
+	mu   sync.Mutex
+	// Held through a whole save, so concurrent saves land in order
+	saveMu sync.Mutex
+}
+
+// DefaultIndexPath returns the index location under the XDG cache directory
+func DefaultIndexPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "listnr", "library.json"), nil
+}
+
+// LoadIndex reads the index at path. A missing or unreadable index yields an
+// empty one.
+func LoadIndex(path string) *Index {
+	index := &Index{
+		Version: indexVersion,
+		Entries: make(map[string]*indexEntry),
+		path:    path,
+		seen:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return index
+	}
+
+	var stored Index
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return index
+	}
+	// An outdated index is read again from scratch
+	if stored.Version != indexVersion {
+		return index
+	}
+	for songPath, entry := range stored.Entries {
+		if entry != nil && entry.Song != nil {
+			entry.Song.loudness = entry.Loudness
+			index.Entries[songPath] = entry
+		}
+	}
+
+	return index
+}
+
+// Lookup returns the cached song for path if the file is unchanged
+func (i *Index) Lookup(path string, info os.FileInfo) *Song {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.seen[path] = true
+	entry, ok := i.Entries[path]
+	if !ok || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() {
+		return nil
+	}
+	return entry.Song
+}
+
+func (i *Index) Store(path string, info os.FileInfo, song *Song) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.seen[path] = true
+	i.Entries[path] = &indexEntry{
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+		Song:    song,
+	}
+}
+
+// Prune drops entries for files that were not visited since the last Prune
+func (i *Index) Prune() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for path := range i.Entries {
+		if !i.seen[path] {
+			delete(i.Entries, path)
+		}
+	}
+	i.seen = make(map[string]bool)
+}
+
+func (i *Index) Save() error {
+	i.saveMu.Lock()
+	defer i.saveMu.Unlock()
+
+	i.mu.Lock()
+	for _, entry := range i.Entries {
+		entry.Loudness = entry.Song.Loudness()
+	}
+	data, err := json.Marshal(i)
+	i.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(i.path, data)
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file, so an interrupted save never leaves it corrupt and saves from other
+// processes, e.g. listnr analyze, never write into each other's
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package library
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestIndexConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.json")
+
+	index := LoadIndex(path)
+	for i := 0; i < 200; i++ {
+		songPath := fmt.Sprintf("/music/%03d.flac", i)
+		index.Entries[songPath] = &indexEntry{Song: &Song{Path: songPath, Name: filepath.Base(songPath)}}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := index.Save(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(LoadIndex(path).Entries); got != 200 {
+		t.Errorf("saved index has %d entries, want 200", got)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("saving left %d files behind, want only library.json", len(files))
+	}
+}
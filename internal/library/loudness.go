@@ -0,0 +1,50 @@
+package library
+
+import "context"
+
+// Save the index every so many analyzed songs so an interrupted run keeps its work
+const analysisSaveInterval = 20
+
+// MeasureFunc measures the loudness of the audio file at path
+type MeasureFunc func(path string) (*Loudness, error)
+
+// AnalysisProgress is called after each song with the measurement or error
+type AnalysisProgress func(song *Song, done, total int, err error)
+
+// NeedsAnalysis reports whether song has neither ReplayGain tags nor a loudness measurement
+func (s *Song) NeedsAnalysis() bool {
+	return s.TrackGain == nil && s.AlbumGain == nil && s.Loudness() == nil
+}
+
+// AnalyzeLoudness measures every song that needs it (every song when force
+// is set) and stores the results in the library index. It stops early when
+// ctx is cancelled.
+func (l *Library) AnalyzeLoudness(ctx context.Context, measure MeasureFunc, force bool, progress AnalysisProgress) error {
+	var songs []*Song
+	for _, song := range l.GetAllSongs() {
+		if force || song.NeedsAnalysis() {
+			songs = append(songs, song)
+		}
+	}
+
+	for i, song := range songs {
+		if err := ctx.Err(); err != nil {
+			l.Save()
+			return err
+		}
+
+		loudness, err := measure(song.Path)
+		if err == nil {
+			song.setLoudness(loudness)
+		}
+
+		if progress != nil {
+			progress(song, i+1, len(songs), err)
+		}
+		if (i+1)%analysisSaveInterval == 0 {
+			l.Save()
+		}
+	}
+
+	return l.Save()
+}
@@ -1,15 +1,40 @@
 package library
 
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
 type Library struct {
 	Directories []*Directory
 	scanner     *Scanner
+	index       *Index
+	store       *SongStore
+	roots       []string
+
+	mu sync.RWMutex
 }
 
 func NewLibrary() *Library {
-	return &Library{
+	lib := &Library{
 		Directories: make([]*Directory, 0),
 		scanner:     NewScanner(),
 	}
+
+	// Without a cache directory every scan simply reads all tags again
+	if path, err := DefaultIndexPath(); err == nil {
+		lib.index = LoadIndex(path)
+		lib.scanner.SetIndex(lib.index)
+	}
+	// Without a data directory play counts, loops and positions last one run
+	if path, err := DefaultSongStorePath(); err == nil {
+		lib.store = LoadSongStore(path)
+		lib.scanner.SetStore(lib.store)
+	}
+
+	return lib
 }
 
 func (l *Library) Scan(paths []string) error {
@@ -18,11 +43,243 @@ func (l *Library) Scan(paths []string) error {
 		return err
 	}
 
+	l.mu.Lock()
 	l.Directories = dirs
+	l.roots = make([]string, len(paths))
+	for i, path := range paths {
+		l.roots[i] = filepath.Clean(path)
+	}
+	l.mu.Unlock()
+
+	if l.index != nil {
+		l.index.Prune()
+		// The index is only a cache, a failed save costs a slower next startup
+		l.index.Save()
+	}
 	return nil
 }
 
+// Refresh rescans the directory at path and swaps the result into the tree.
+// Published directories are never modified: the rescanned one and its
+// ancestors are replaced by copies, so readers holding a tree keep a
+// consistent snapshot and look directories up again by path.
+func (l *Library) Refresh(path string) {
+	path = filepath.Clean(path)
+
+	l.mu.RLock()
+	root := l.rootFor(path)
+	l.mu.RUnlock()
+	if root == "" {
+		return
+	}
+
+	for {
+		// New directories are picked up by rescanning their closest known ancestor
+		if path != root && l.FindDirectory(path) == nil {
+			path = filepath.Dir(path)
+			continue
+		}
+
+		// Scan without the lock so readers aren't held up by the disk
+		fresh, err := l.scanner.ScanDirectory(path)
+		if err != nil || fresh == nil || (len(fresh.Songs) == 0 && len(fresh.Dirs) == 0) {
+			fresh = nil
+		}
+
+		// Emptied directories are dropped when their parent is rescanned
+		if fresh == nil && path != root {
+			path = filepath.Dir(path)
+			continue
+		}
+
+		l.mu.Lock()
+		l.Directories = l.replaceDirectory(path, fresh)
+		l.mu.Unlock()
+		break
+	}
+
+	if l.index != nil {
+		l.index.Save()
+	}
+}
+
+// replaceDirectory returns the roots with the directory at path replaced by
+// fresh, or removed when fresh is nil
+func (l *Library) replaceDirectory(path string, fresh *Directory) []*Directory {
+	if dirs, ok := replaceIn(l.Directories, path, fresh); ok {
+		return dirs
+	}
+	if fresh == nil {
+		return l.Directories
+	}
+
+	// A root that had no songs before, kept in configuration order
+	var dirs []*Directory
+	for _, root := range l.roots {
+		if root == path {
+			dirs = append(dirs, fresh)
+		} else if dir := l.findRoot(root); dir != nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// replaceIn replaces the directory at path within dirs, copying the
+// directories leading to it, and reports whether it was found
+func replaceIn(dirs []*Directory, path string, fresh *Directory) ([]*Directory, bool) {
+	for i, dir := range dirs {
+		dirPath := filepath.Clean(dir.Path)
+
+		var replacement *Directory
+		switch {
+		case dirPath == path:
+			replacement = fresh
+		case strings.HasPrefix(path, dirPath+string(filepath.Separator)):
+			subDirs, ok := replaceIn(dir.Dirs, path, fresh)
+			if !ok {
+				return dirs, false
+			}
+			replacement = &Directory{Path: dir.Path, Name: dir.Name, Songs: dir.Songs, Dirs: subDirs}
+		default:
+			continue
+		}
+
+		replaced := make([]*Directory, 0, len(dirs))
+		replaced = append(replaced, dirs[:i]...)
+		if replacement != nil {
+			replaced = append(replaced, replacement)
+		}
+		return append(replaced, dirs[i+1:]...), true
+	}
+	return dirs, false
+}
+
+// RecordPlay counts a playback of song towards weighted shuffle
+func (l *Library) RecordPlay(song *Song) {
+	l.updateSong(song, func(data *SongData) {
+		data.PlayCount++
+	})
+}
+
+// SetLoop remembers the A-B loop of song, or forgets it when loop is nil
+func (l *Library) SetLoop(song *Song, loop *Loop) {
+	l.updateSong(song, func(data *SongData) {
+		data.Loop = loop
+	})
+}
+
+// SetResume remembers position as where to resume song, reporting whether
+// the song went from unplayed to started or between started and finished
+func (l *Library) SetResume(song *Song, position, duration time.Duration) bool {
+	var changed bool
+	l.updateSong(song, func(data *SongData) {
+		old := data.Resume
+		data.Resume = &Resume{Position: position, Duration: duration}
+		changed = old == nil || old.Finished() != data.Resume.Finished()
+	})
+	return changed
+}
+
+// FinishResume marks song finished if a resume position is kept for it,
+// reporting whether it wasn't already
+func (l *Library) FinishResume(song *Song) bool {
+	var changed bool
+	l.updateSong(song, func(data *SongData) {
+		old := data.Resume
+		if old == nil || old.Finished() {
+			return
+		}
+		data.Resume = &Resume{Position: old.Duration, Duration: old.Duration}
+		changed = true
+	})
+	return changed
+}
+
+// updateSong applies change to the data kept about song, in the song store
+// when there is one
+func (l *Library) updateSong(song *Song, change func(data *SongData)) {
+	if l.store == nil {
+		song.update(change)
+		return
+	}
+	l.store.update(song, change)
+}
+
+// Save writes the library index and the song store, persisting loudness
+// measurements, play counts, loops and resume positions
+func (l *Library) Save() error {
+	var err error
+	if l.index != nil {
+		err = l.index.Save()
+	}
+	if l.store != nil {
+		if storeErr := l.store.Save(); storeErr != nil {
+			err = storeErr
+		}
+	}
+	return err
+}
+
+// SaveSongData writes the song store if anything in it changed, leaving
+// out the index, which is only a cache and costly to write
+func (l *Library) SaveSongData() error {
+	if l.store == nil {
+		return nil
+	}
+	return l.store.Save()
+}
+
+func (l *Library) rootFor(path string) string {
+	for _, root := range l.roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return root
+		}
+	}
+	return ""
+}
+
+func (l *Library) findRoot(path string) *Directory {
+	for _, dir := range l.Directories {
+		if filepath.Clean(dir.Path) == path {
+			return dir
+		}
+	}
+	return nil
+}
+
+func (l *Library) findDirectory(path string) *Directory {
+	var find func(*Directory) *Directory
+	find = func(dir *Directory) *Directory {
+		if filepath.Clean(dir.Path) == path {
+			return dir
+		}
+		for _, subDir := range dir.Dirs {
+			if found := find(subDir); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	for _, dir := range l.Directories {
+		if found := find(dir); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (l *Library) FindDirectory(path string) *Directory {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.findDirectory(filepath.Clean(path))
+}
+
 func (l *Library) FindSong(path string) (*Song, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	for _, dir := range l.Directories {
 		if song := dir.FindSong(path); song != nil {
 			return song, nil
@@ -32,6 +289,9 @@ func (l *Library) FindSong(path string) (*Song, error) {
 }
 
 func (l *Library) GetAllSongs() []*Song {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	var songs []*Song
 	for _, dir := range l.Directories {
 		songs = append(songs, dir.GetAllSongs()...)
@@ -40,5 +300,13 @@ func (l *Library) GetAllSongs() []*Song {
 }
 
 func (l *Library) GetDirectories() []*Directory {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.Directories
 }
+
+func (l *Library) Roots() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.roots
+}
@@ -1,15 +1,131 @@
 package library
 
-import "time"
+import (
+	"math"
+	"sync"
+	"time"
+)
 
 type Song struct {
-	Path     string        `json:"path"`
-	Name     string        `json:"name"`
+	Path        string        `json:"path"`
+	Name        string        `json:"name"`
+	Duration    time.Duration `json:"duration"`
+	Title       string        `json:"title,omitempty"`
+	Artist      string        `json:"artist,omitempty"`
+	Album       string        `json:"album,omitempty"`
+	AlbumArtist string        `json:"album_artist,omitempty"`
+	TrackNumber int           `json:"track_number,omitempty"`
+	DiscNumber  int           `json:"disc_number,omitempty"`
+	Year        int           `json:"year,omitempty"`
+	Genre       string        `json:"genre,omitempty"`
+	Rating      int           `json:"rating,omitempty"` // 1-5 stars, 0 when unrated
+	TrackGain   *Gain         `json:"track_gain,omitempty"`
+	AlbumGain   *Gain         `json:"album_gain,omitempty"`
+
+	// Changed while the song may be playing, so guarded by mu. The index
+	// caches the loudness along with the tags, the song store keeps data.
+	loudness *Loudness
+	data     SongData
+	mu       sync.RWMutex
+}
+
+// Loudness returns the EBU R128 measurement of the song, nil if not measured
+func (s *Song) Loudness() *Loudness {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loudness
+}
+
+func (s *Song) setLoudness(loudness *Loudness) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loudness = loudness
+}
+
+// PlayCount returns how many times the song was played
+func (s *Song) PlayCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.PlayCount
+}
+
+// Loop returns the A-B loop remembered for the song, nil if there is none
+func (s *Song) Loop() *Loop {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Loop
+}
+
+// Resume returns where playback of the song stopped, nil if not kept
+func (s *Song) Resume() *Resume {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.Resume
+}
+
+// update applies change to the data of the song, returning the result
+func (s *Song) update(change func(data *SongData)) SongData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(&s.data)
+	return s.data
+}
+
+// Resume is where playback of a long song, e.g. an audiobook, stopped
+type Resume struct {
+	Position time.Duration `json:"position"`
 	Duration time.Duration `json:"duration"`
-	Artist   string        `json:"artist,omitempty"`
-	Album    string        `json:"album,omitempty"`
 }
 
+// resumeFinishedMargin is how close to the end a song counts as finished,
+// so outros and credits don't leave it half played
+const resumeFinishedMargin = 30 * time.Second
+
+// Finished reports whether playback got to the end of the song
+func (r *Resume) Finished() bool {
+	return r.Position >= r.Duration-resumeFinishedMargin
+}
+
+// Loop is a section of a song played over and over
+type Loop struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+}
+
+// Gain is a ReplayGain adjustment in dB and the linear sample peak it refers to
+type Gain struct {
+	Gain float64 `json:"gain"`
+	Peak float64 `json:"peak,omitempty"`
+}
+
+// ReferenceLoudness is the ReplayGain 2.0 target level in LUFS
+const ReferenceLoudness = -18.0
+
+// Loudness is an EBU R128 measurement of a song
+type Loudness struct {
+	Integrated float64 `json:"integrated"` // LUFS
+	Range      float64 `json:"range"`      // LU
+	TruePeak   float64 `json:"true_peak"`  // dBTP
+}
+
+// Gain converts the measurement to a ReplayGain style track gain
+func (l *Loudness) Gain() *Gain {
+	return &Gain{
+		Gain: ReferenceLoudness - l.Integrated,
+		Peak: math.Pow(10, l.TruePeak/20),
+	}
+}
+
+// DisplayName returns the tagged title, falling back to the file name
+func (s *Song) DisplayName() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return s.Name
+}
+
+// Directory is a scanned directory. It is not modified once in the library,
+// a rescan replaces it instead.
 type Directory struct {
 	Path  string       `json:"path"`
 	Name  string       `json:"name"`
@@ -0,0 +1,116 @@
+package library
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sammwyy/listnr/internal/mp4"
+)
+
+var mp4Atoms = map[string]string{
+	"\xa9nam": tagTitle,
+	"\xa9ART": tagArtist,
+	"\xa9alb": tagAlbum,
+	"aART":    tagAlbumArtist,
+	"\xa9day": tagDate,
+	"\xa9gen": tagGenre,
+}
+
+func readM4A(r io.ReaderAt, size int64, meta *metadata) error {
+	top, err := mp4.ReadBoxes(r, 0, size)
+	if len(top) == 0 {
+		return err
+	}
+
+	if mvhd, ok := mp4.FindPath(r, top, "moov", "mvhd"); ok {
+		meta.duration = mp4Duration(r, mvhd)
+	}
+
+	ilst, ok := mp4.FindPath(r, top, "moov", "udta", "meta", "ilst")
+	if !ok {
+		return nil
+	}
+
+	items, err := mp4.Children(r, ilst)
+	for _, item := range items {
+		if item.Type == "covr" || item.Size > 1<<20 {
+			continue
+		}
+		children, _ := mp4.Children(r, item)
+
+		var name string
+		for _, child := range children {
+			switch child.Type {
+			case "name":
+				// Freeform "----" atoms carry their key in a name atom
+				if data := readAtomData(r, child); len(data) > 4 {
+					name = string(data[4:])
+				}
+			case "data":
+				data := readAtomData(r, child)
+				if len(data) < 8 {
+					continue
+				}
+				readM4AItem(item.Type, name, data[8:], meta)
+			}
+		}
+	}
+
+	return err
+}
+
+func readM4AItem(kind, name string, value []byte, meta *metadata) {
+	switch kind {
+	case "trkn", "disk":
+		if len(value) >= 4 {
+			key := tagTrack
+			if kind == "disk" {
+				key = tagDisc
+			}
+			meta.set(key, strconv.Itoa(int(binary.BigEndian.Uint16(value[2:4]))))
+		}
+	case "gnre":
+		if len(value) >= 2 {
+			if n := int(binary.BigEndian.Uint16(value)) - 1; n >= 0 && n < len(id3Genres) {
+				meta.set(tagGenre, id3Genres[n])
+			}
+		}
+	case "----":
+		meta.set(name, string(value))
+	default:
+		if key, ok := mp4Atoms[kind]; ok {
+			meta.set(key, string(value))
+		}
+	}
+}
+
+// readAtomData reads the payload of a small atom, nil when unreadable
+func readAtomData(r io.ReaderAt, a mp4.Box) []byte {
+	data, err := mp4.ReadData(r, a)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func mp4Duration(r io.ReaderAt, mvhd mp4.Box) time.Duration {
+	data := readAtomData(r, mvhd)
+
+	var timescale uint32
+	var duration uint64
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		timescale = binary.BigEndian.Uint32(data[20:24])
+		duration = binary.BigEndian.Uint64(data[24:32])
+	case len(data) >= 20:
+		timescale = binary.BigEndian.Uint32(data[12:16])
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0
+	}
+	return time.Duration(duration) * time.Second / time.Duration(timescale)
+}
@@ -0,0 +1,433 @@
+package library
+
+import "sync"
+
+// Queue is the ordered list of songs playback advances through, independent
+// of the directory being browsed
+type Queue struct {
+	songs   []*Song
+	current int // index of the playing song, -1 when nothing is playing
+
+	// removed is set when the playing song was taken out of the queue. It
+	// keeps playing, and current is the slot the following song moved into.
+	removed bool
+
+	// While shuffling, songs holds the shuffled play order and original the
+	// order to return to when shuffle is turned off
+	shuffle  ShuffleMode
+	original []*Song
+
+	mu sync.RWMutex
+}
+
+func NewQueue() *Queue {
+	return &Queue{current: -1, shuffle: ShuffleOff}
+}
+
+// Songs returns a copy of the queued songs
+func (q *Queue) Songs() []*Song {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	songs := make([]*Song, len(q.songs))
+	copy(songs, q.songs)
+	return songs
+}
+
+func (q *Queue) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return len(q.songs)
+}
+
+// CurrentIndex returns the index of the playing song, -1 when nothing is
+// playing or the playing song was removed from the queue
+func (q *Queue) CurrentIndex() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.removed {
+		return -1
+	}
+	return q.current
+}
+
+func (q *Queue) Current() *Song {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.removed || q.current < 0 || q.current >= len(q.songs) {
+		return nil
+	}
+	return q.songs[q.current]
+}
+
+// upcoming returns the index of the song that plays after the current one
+func (q *Queue) upcoming() int {
+	if q.removed {
+		return q.current
+	}
+	return q.current + 1
+}
+
+// Snapshot returns the play order, the unshuffled order while shuffling (nil
+// otherwise) and the current index, for saving the session
+func (q *Queue) Snapshot() (songs, original []*Song, current int) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	songs = make([]*Song, len(q.songs))
+	copy(songs, q.songs)
+	if q.original != nil {
+		original = make([]*Song, len(q.original))
+		copy(original, q.original)
+	}
+	// A removed song isn't restored, so the song after it comes next
+	return songs, original, q.upcoming() - 1
+}
+
+// Restore brings back a queue saved with Snapshot as it was, without
+// reshuffling
+func (q *Queue) Restore(songs, original []*Song, current int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.songs = make([]*Song, len(songs))
+	copy(q.songs, songs)
+
+	q.original = nil
+	if q.shuffle != ShuffleOff {
+		if original == nil {
+			original = songs
+		}
+		q.original = make([]*Song, len(original))
+		copy(q.original, original)
+	}
+
+	q.current = current
+	q.removed = false
+	if current < -1 || current >= len(q.songs) {
+		q.current = -1
+	}
+}
+
+// Replace swaps the whole queue, e.g. when starting playback of a directory.
+// When shuffling, the song at current plays first and the rest are shuffled.
+func (q *Queue) Replace(songs []*Song, current int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.songs = make([]*Song, len(songs))
+	copy(q.songs, songs)
+	q.current = current
+	q.removed = false
+	if q.current >= len(q.songs) {
+		q.current = -1
+	}
+
+	q.original = nil
+	if q.shuffle != ShuffleOff {
+		q.original = make([]*Song, len(songs))
+		copy(q.original, songs)
+
+		// Every other song is still to come, not just those after current
+		if q.current > 0 {
+			chosen := q.songs[q.current]
+			copy(q.songs[1:q.current+1], q.songs[:q.current])
+			q.songs[0] = chosen
+			q.current = 0
+		}
+		q.shuffleUpcoming()
+	}
+}
+
+func (q *Queue) Append(songs ...*Song) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.songs = append(q.songs, songs...)
+	if q.original != nil {
+		q.original = append(q.original, songs...)
+	}
+}
+
+// PlayNext inserts songs right after the current one
+func (q *Queue) PlayNext(songs ...*Song) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	at := q.upcoming()
+	rest := append([]*Song{}, q.songs[at:]...)
+	q.songs = append(append(q.songs[:at], songs...), rest...)
+	if q.original != nil {
+		q.original = append(q.original, songs...)
+	}
+}
+
+func (q *Queue) Shuffle() ShuffleMode {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.shuffle
+}
+
+// SetShuffle reorders the songs after the current one for mode. Turning
+// shuffle off restores the order the songs were queued in.
+func (q *Queue) SetShuffle(mode ShuffleMode) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if mode == "" {
+		mode = ShuffleOff
+	}
+	if mode == q.shuffle {
+		return
+	}
+	q.shuffle = mode
+
+	if mode == ShuffleOff {
+		q.restoreOrder()
+		return
+	}
+
+	if q.original == nil {
+		q.original = make([]*Song, len(q.songs))
+		copy(q.original, q.songs)
+	}
+	q.shuffleUpcoming()
+}
+
+// shuffleUpcoming shuffles the songs that have not been played yet, so
+// Previous keeps walking back through the same history
+func (q *Queue) shuffleUpcoming() {
+	start := q.upcoming()
+	if start < 0 {
+		start = 0
+	}
+	upcoming := q.songs[start:]
+
+	// Album shuffle finishes the playing album before moving to another one
+	var head []*Song
+	if q.shuffle == ShuffleAlbum && q.current >= 0 && !q.removed {
+		playing := q.songs[q.current]
+		key := albumKey(playing)
+
+		position := make(map[*Song]int, len(q.original))
+		for i, song := range q.original {
+			if _, ok := position[song]; !ok {
+				position[song] = i
+			}
+		}
+
+		var rest []*Song
+		for _, song := range upcoming {
+			if albumKey(song) == key && position[song] > position[playing] {
+				head = append(head, song)
+			} else {
+				rest = append(rest, song)
+			}
+		}
+		upcoming = rest
+	}
+
+	shuffled := append(head, shuffleSongs(upcoming, q.shuffle)...)
+	q.songs = append(q.songs[:start], shuffled...)
+}
+
+// restoreOrder puts the queue back in its unshuffled order, dropping removed
+// songs and appending any the original order does not know about
+func (q *Queue) restoreOrder() {
+	if q.original == nil {
+		return
+	}
+
+	// While the playing song is removed, follow the song in its slot instead
+	var playing *Song
+	if q.current >= 0 && q.current < len(q.songs) {
+		playing = q.songs[q.current]
+	}
+
+	remaining := make(map[*Song]int, len(q.songs))
+	for _, song := range q.songs {
+		remaining[song]++
+	}
+
+	songs := make([]*Song, 0, len(q.songs))
+	for _, song := range q.original {
+		if remaining[song] > 0 {
+			remaining[song]--
+			songs = append(songs, song)
+		}
+	}
+	for _, song := range q.songs {
+		if remaining[song] > 0 {
+			remaining[song]--
+			songs = append(songs, song)
+		}
+	}
+
+	q.songs = songs
+	q.original = nil
+	if q.removed && playing == nil {
+		q.current = len(songs)
+	}
+	if playing != nil {
+		for i, song := range songs {
+			if song == playing {
+				q.current = i
+				break
+			}
+		}
+	}
+}
+
+func (q *Queue) Remove(index int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if index < 0 || index >= len(q.songs) {
+		return
+	}
+
+	removed := q.songs[index]
+	q.songs = append(q.songs[:index], q.songs[index+1:]...)
+	if q.original != nil {
+		for i, song := range q.original {
+			if song == removed {
+				q.original = append(q.original[:i], q.original[i+1:]...)
+				break
+			}
+		}
+	}
+
+	switch {
+	case index < q.current:
+		q.current--
+	case index == q.current:
+		// The playing song keeps playing but is no longer part of the queue;
+		// the next song moves into its slot and plays after it
+		q.removed = true
+	}
+}
+
+// Move relocates the song at from to position to, keeping track of the current song
+func (q *Queue) Move(from, to int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if from < 0 || from >= len(q.songs) || to < 0 || to >= len(q.songs) || from == to {
+		return
+	}
+
+	song := q.songs[from]
+	q.songs = append(q.songs[:from], q.songs[from+1:]...)
+	q.songs = append(q.songs[:to], append([]*Song{song}, q.songs[to:]...)...)
+
+	switch {
+	case q.removed:
+		// current is where the songs still to come start
+		if from < q.current && to >= q.current {
+			q.current--
+		} else if from >= q.current && to < q.current {
+			q.current++
+		}
+	case q.current == from:
+		q.current = to
+	case from < q.current && to >= q.current:
+		q.current--
+	case from > q.current && to <= q.current:
+		q.current++
+	}
+}
+
+func (q *Queue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.songs = nil
+	q.original = nil
+	q.current = -1
+	q.removed = false
+}
+
+// Jump makes the song at index current and returns it
+func (q *Queue) Jump(index int) *Song {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if index < 0 || index >= len(q.songs) {
+		return nil
+	}
+	q.current = index
+	q.removed = false
+	return q.songs[index]
+}
+
+// Peek returns the song after the current one without advancing
+func (q *Queue) Peek() *Song {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	next := q.upcoming()
+	if next >= len(q.songs) {
+		return nil
+	}
+	return q.songs[next]
+}
+
+// Next advances to the following song, returning nil at the end of the queue
+func (q *Queue) Next() *Song {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	next := q.upcoming()
+	if next >= len(q.songs) {
+		return nil
+	}
+	q.current = next
+	q.removed = false
+	return q.songs[q.current]
+}
+
+// Restart goes back to the first song for another pass over the queue.
+// When shuffling, the whole queue is shuffled again for the new pass.
+func (q *Queue) Restart() *Song {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.songs) == 0 {
+		return nil
+	}
+
+	if q.shuffle != ShuffleOff {
+		var last *Song
+		if q.current >= 0 && q.current < len(q.songs) && !q.removed {
+			last = q.songs[q.current]
+		}
+		q.current = -1
+		q.removed = false
+		q.shuffleUpcoming()
+		// Avoid playing the same song twice in a row across passes
+		if q.shuffle != ShuffleAlbum && len(q.songs) > 1 && q.songs[0] == last {
+			q.songs[0], q.songs[len(q.songs)-1] = q.songs[len(q.songs)-1], q.songs[0]
+		}
+	}
+
+	q.current = 0
+	q.removed = false
+	return q.songs[0]
+}
+
+// Previous steps back to the preceding song, returning nil at the start of the queue
+func (q *Queue) Previous() *Song {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.current <= 0 || len(q.songs) == 0 {
+		return nil
+	}
+	q.current--
+	q.removed = false
+	if q.current >= len(q.songs) {
+		q.current = len(q.songs) - 1
+	}
+	return q.songs[q.current]
+}
@@ -0,0 +1,109 @@
+package library
+
+import "testing"
+
+func testSongs(names ...string) []*Song {
+	songs := make([]*Song, len(names))
+	for i, name := range names {
+		songs[i] = &Song{Name: name, Path: "/music/" + name}
+	}
+	return songs
+}
+
+func TestQueueRemoveBeforeCurrent(t *testing.T) {
+	songs := testSongs("a", "b", "c", "d")
+	q := NewQueue()
+	q.Replace(songs, 2)
+
+	q.Remove(0)
+
+	if got := q.Current(); got != songs[2] {
+		t.Fatalf("Current() = %v, want %v", got, songs[2])
+	}
+	if got := q.CurrentIndex(); got != 1 {
+		t.Fatalf("CurrentIndex() = %d, want 1", got)
+	}
+	if got := q.Next(); got != songs[3] {
+		t.Fatalf("Next() = %v, want %v", got, songs[3])
+	}
+	q.Previous()
+	if got := q.Previous(); got != songs[1] {
+		t.Fatalf("Previous() = %v, want %v", got, songs[1])
+	}
+}
+
+func TestQueueRemoveCurrent(t *testing.T) {
+	songs := testSongs("a", "b", "c", "d")
+
+	t.Run("next plays the song that moved into its slot", func(t *testing.T) {
+		q := NewQueue()
+		q.Replace(songs, 1)
+
+		q.Remove(1)
+
+		if got := q.Current(); got != nil {
+			t.Fatalf("Current() = %v, want nil", got)
+		}
+		if got := q.CurrentIndex(); got != -1 {
+			t.Fatalf("CurrentIndex() = %d, want -1", got)
+		}
+		if got := q.Peek(); got != songs[2] {
+			t.Fatalf("Peek() = %v, want %v", got, songs[2])
+		}
+		if got := q.Next(); got != songs[2] {
+			t.Fatalf("Next() = %v, want %v", got, songs[2])
+		}
+		if got := q.CurrentIndex(); got != 1 {
+			t.Fatalf("CurrentIndex() after Next = %d, want 1", got)
+		}
+	})
+
+	t.Run("previous plays the song before it", func(t *testing.T) {
+		q := NewQueue()
+		q.Replace(songs, 1)
+
+		q.Remove(1)
+
+		if got := q.Previous(); got != songs[0] {
+			t.Fatalf("Previous() = %v, want %v", got, songs[0])
+		}
+	})
+
+	t.Run("first song", func(t *testing.T) {
+		q := NewQueue()
+		q.Replace(songs, 0)
+
+		q.Remove(0)
+
+		if got := q.Next(); got != songs[1] {
+			t.Fatalf("Next() = %v, want %v", got, songs[1])
+		}
+	})
+
+	t.Run("last song", func(t *testing.T) {
+		q := NewQueue()
+		q.Replace(songs, 3)
+
+		q.Remove(3)
+
+		if got := q.Next(); got != nil {
+			t.Fatalf("Next() = %v, want nil", got)
+		}
+		if got := q.Previous(); got != songs[2] {
+			t.Fatalf("Previous() = %v, want %v", got, songs[2])
+		}
+	})
+
+	t.Run("play next goes into its slot", func(t *testing.T) {
+		q := NewQueue()
+		q.Replace(songs, 1)
+		extra := testSongs("e")[0]
+
+		q.Remove(1)
+		q.PlayNext(extra)
+
+		if got := q.Next(); got != extra {
+			t.Fatalf("Next() = %v, want %v", got, extra)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package library
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+var riffInfoFields = map[string]string{
+	"INAM": tagTitle,
+	"IART": tagArtist,
+	"IPRD": tagAlbum,
+	"IGNR": tagGenre,
+	"ICRD": tagDate,
+	"ITRK": tagTrack,
+	"IPRT": tagTrack,
+}
+
+func readWAV(r io.ReaderAt, size int64, meta *metadata) error {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return errors.New("wav: missing RIFF/WAVE header")
+	}
+
+	var byteRate uint32
+	offset := int64(12)
+	chunk := make([]byte, 8)
+
+	for offset+8 <= size {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return err
+		}
+		id := string(chunk[:4])
+		length := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		body := offset + 8
+
+		switch id {
+		case "fmt ":
+			fmtChunk := make([]byte, 12)
+			if _, err := r.ReadAt(fmtChunk, body); err != nil {
+				return err
+			}
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+		case "data":
+			// Streams written on the fly may leave the size unset
+			if length == 0 || body+length > size {
+				length = size - body
+			}
+			if byteRate > 0 {
+				meta.duration = time.Duration(length) * time.Second / time.Duration(byteRate)
+			}
+		case "LIST":
+			if err := readRIFFInfo(r, body, length, meta); err != nil {
+				return err
+			}
+		case "id3 ", "ID3 ":
+			if _, err := readID3v2(r, body, meta); err != nil {
+				return err
+			}
+		}
+
+		// Chunks are padded to an even size
+		offset = body + length + length%2
+	}
+
+	return nil
+}
+
+func readRIFFInfo(r io.ReaderAt, offset, length int64, meta *metadata) error {
+	if length < 4 || length > 1<<20 {
+		return nil
+	}
+
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset); err != nil {
+		return err
+	}
+	if string(data[:4]) != "INFO" {
+		return nil
+	}
+	data = data[4:]
+
+	for len(data) >= 8 {
+		id := string(data[:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if 8+size > len(data) {
+			break
+		}
+
+		if key, ok := riffInfoFields[id]; ok {
+			meta.set(key, string(data[8:8+size]))
+		}
+
+		next := 8 + size + size%2
+		if next > len(data) {
+			break
+		}
+		data = data[next:]
+	}
+
+	return nil
+}
@@ -10,6 +10,8 @@ import (
 
 type Scanner struct {
 	supportedExts map[string]bool
+	index         *Index
+	store         *SongStore
 }
 
 func NewScanner() *Scanner {
@@ -55,26 +57,73 @@ func (s *Scanner) ScanDirectory(path string) (*Directory, error) {
 		} else {
 			ext := strings.ToLower(filepath.Ext(entry.Name()))
 			if s.IsSupported(ext) {
-				song := &Song{
-					Path: fullPath,
-					Name: strings.TrimSuffix(entry.Name(), ext),
-				}
-				dir.Songs = append(dir.Songs, song)
+				dir.Songs = append(dir.Songs, s.readSong(fullPath, entry))
 			}
 		}
 	}
 
-	// Sort directories and songs alphabetically
-	sort.Slice(dir.Dirs, func(i, j int) bool {
+	// Sort directories alphabetically, songs in album order: those tagged
+	// with track numbers by disc and track, followed by the rest by name
+	sort.SliceStable(dir.Dirs, func(i, j int) bool {
 		return dir.Dirs[i].Name < dir.Dirs[j].Name
 	})
-	sort.Slice(dir.Songs, func(i, j int) bool {
-		return dir.Songs[i].Name < dir.Songs[j].Name
+	sort.SliceStable(dir.Songs, func(i, j int) bool {
+		a, b := dir.Songs[i], dir.Songs[j]
+		aTagged, bTagged := a.TrackNumber > 0, b.TrackNumber > 0
+		if aTagged != bTagged {
+			return aTagged
+		}
+		if aTagged {
+			if a.DiscNumber != b.DiscNumber {
+				return a.DiscNumber < b.DiscNumber
+			}
+			if a.TrackNumber != b.TrackNumber {
+				return a.TrackNumber < b.TrackNumber
+			}
+		}
+		return a.Name < b.Name
 	})
 
 	return dir, nil
 }
 
+// readSong returns the indexed song when the file is unchanged, otherwise
+// reads its tags again
+func (s *Scanner) readSong(path string, info os.FileInfo) *Song {
+	var song *Song
+	if s.index != nil {
+		song = s.index.Lookup(path, info)
+	}
+
+	if song == nil {
+		song = &Song{
+			Path: path,
+			Name: strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())),
+		}
+		// Unreadable tags still leave a playable song
+		ReadMetadata(song)
+
+		if s.index != nil {
+			s.index.Store(path, info, song)
+		}
+	}
+
+	// Play counts, loops and resume positions belong to listnr, not the
+	// file, so retagging keeps them
+	if s.store != nil {
+		s.store.load(song)
+	}
+	return song
+}
+
+func (s *Scanner) SetIndex(index *Index) {
+	s.index = index
+}
+
+func (s *Scanner) SetStore(store *SongStore) {
+	s.store = store
+}
+
 func (s *Scanner) IsSupported(ext string) bool {
 	return s.supportedExts[strings.ToLower(ext)]
 }
@@ -0,0 +1,108 @@
+package library
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+)
+
+type ShuffleMode string
+
+const (
+	ShuffleOff      ShuffleMode = "off"
+	ShuffleTrack    ShuffleMode = "track"
+	ShuffleAlbum    ShuffleMode = "album"
+	ShuffleWeighted ShuffleMode = "weighted"
+)
+
+// Next returns the mode following m in the toggle cycle
+func (m ShuffleMode) Next() ShuffleMode {
+	switch m {
+	case ShuffleTrack:
+		return ShuffleAlbum
+	case ShuffleAlbum:
+		return ShuffleWeighted
+	case ShuffleWeighted:
+		return ShuffleOff
+	default:
+		return ShuffleTrack
+	}
+}
+
+// shuffleSongs returns a new ordering of songs for the given mode
+func shuffleSongs(songs []*Song, mode ShuffleMode) []*Song {
+	shuffled := make([]*Song, len(songs))
+	copy(shuffled, songs)
+
+	switch mode {
+	case ShuffleTrack:
+		rand.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+	case ShuffleAlbum:
+		shuffled = shuffleAlbums(shuffled)
+	case ShuffleWeighted:
+		shuffled = shuffleWeighted(shuffled)
+	}
+
+	return shuffled
+}
+
+// shuffleAlbums randomizes the album order while keeping each album's tracks in order
+func shuffleAlbums(songs []*Song) []*Song {
+	var keys []string
+	albums := make(map[string][]*Song)
+	for _, song := range songs {
+		key := albumKey(song)
+		if _, ok := albums[key]; !ok {
+			keys = append(keys, key)
+		}
+		albums[key] = append(albums[key], song)
+	}
+
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+
+	shuffled := make([]*Song, 0, len(songs))
+	for _, key := range keys {
+		shuffled = append(shuffled, albums[key]...)
+	}
+	return shuffled
+}
+
+func albumKey(song *Song) string {
+	artist := song.AlbumArtist
+	if artist == "" {
+		artist = song.Artist
+	}
+	if song.Album != "" {
+		return artist + "\x00" + song.Album
+	}
+	// Untagged songs are grouped by directory
+	return "\x00" + filepath.Dir(song.Path)
+}
+
+// shuffleWeighted orders songs by weighted random sampling without
+// replacement (Efraimidis-Spirakis), so favourites tend to come up earlier
+func shuffleWeighted(songs []*Song) []*Song {
+	keys := make(map[*Song]float64, len(songs))
+	for _, song := range songs {
+		keys[song] = math.Pow(rand.Float64(), 1/songWeight(song))
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		return keys[songs[i]] > keys[songs[j]]
+	})
+	return songs
+}
+
+func songWeight(song *Song) float64 {
+	weight := 1 + math.Log1p(float64(song.PlayCount()))
+	if song.Rating > 0 {
+		// 1-5 stars scale the weight from 0.4x to 2x; unrated songs stay neutral
+		weight *= float64(song.Rating) / 2.5
+	}
+	return weight
+}
@@ -0,0 +1,126 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sammwyy/listnr/internal/config"
+)
+
+const songStoreVersion = 1
+
+// SongData is what listnr itself remembers about a song, as opposed to what
+// the file and its tags say
+type SongData struct {
+	PlayCount int     `json:"play_count,omitempty"`
+	Loop      *Loop   `json:"loop,omitempty"`
+	Resume    *Resume `json:"resume,omitempty"`
+}
+
+func (d SongData) empty() bool {
+	return d.PlayCount == 0 && d.Loop == nil && d.Resume == nil
+}
+
+// SongStore keeps SongData by song path. Unlike the index it is not a cache
+// and lives in the data directory, so deleting the index keeps it.
+type SongStore struct {
+	Version int                  `json:"version"`
+	Songs   map[string]*SongData `json:"songs"`
+
+	path  string
+	dirty bool
+	mu    sync.Mutex
+	// Held through a whole save, so concurrent saves land in order
+	saveMu sync.Mutex
+}
+
+// DefaultSongStorePath returns the store location under the XDG data directory
+func DefaultSongStorePath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "songs.json"), nil
+}
+
+// LoadSongStore reads the store at path. A missing or unreadable store
+// yields an empty one.
+func LoadSongStore(path string) *SongStore {
+	store := &SongStore{
+		Version: songStoreVersion,
+		Songs:   make(map[string]*SongData),
+		path:    path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return store
+	}
+
+	var stored SongStore
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return store
+	}
+	for songPath, songData := range stored.Songs {
+		if songData != nil {
+			store.Songs[songPath] = songData
+		}
+	}
+
+	return store
+}
+
+// load gives song the data stored for its path
+func (s *SongStore) load(song *Song) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data SongData
+	if stored := s.Songs[song.Path]; stored != nil {
+		data = *stored
+	}
+	song.update(func(d *SongData) { *d = data })
+}
+
+// update applies change to the data of song and stores the result
+func (s *SongStore) update(song *Song, change func(data *SongData)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := song.update(change)
+	if data.empty() {
+		delete(s.Songs, song.Path)
+	} else {
+		s.Songs[song.Path] = &data
+	}
+	s.dirty = true
+}
+
+// Save writes the store if anything changed since it was loaded or last saved
+func (s *SongStore) Save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		// Try again on the next save
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package library
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Canonical field names shared by every tag reader
+const (
+	tagTitle       = "title"
+	tagArtist      = "artist"
+	tagAlbum       = "album"
+	tagAlbumArtist = "albumartist"
+	tagTrack       = "tracknumber"
+	tagDisc        = "discnumber"
+	tagDate        = "date"
+	tagGenre       = "genre"
+	tagRating      = "rating"
+
+	tagTrackGain = "replaygain_track_gain"
+	tagTrackPeak = "replaygain_track_peak"
+	tagAlbumGain = "replaygain_album_gain"
+	tagAlbumPeak = "replaygain_album_peak"
+)
+
+// metadata is the format-independent result of reading a file's tags
+type metadata struct {
+	fields   map[string]string
+	duration time.Duration
+}
+
+func newMetadata() *metadata {
+	return &metadata{fields: make(map[string]string)}
+}
+
+// set stores a field unless an earlier (higher priority) tag already provided it
+func (m *metadata) set(key, value string) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if key == "" || value == "" {
+		return
+	}
+	if _, exists := m.fields[key]; !exists {
+		m.fields[key] = value
+	}
+}
+
+// ReadMetadata fills the song's tag fields and duration from the file at song.Path
+func ReadMetadata(song *Song) error {
+	file, err := os.Open(song.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	meta := newMetadata()
+	switch strings.ToLower(filepath.Ext(song.Path)) {
+	case ".mp3":
+		err = readMP3(file, info.Size(), meta)
+	case ".flac":
+		err = readFLAC(file, meta)
+	case ".ogg":
+		err = readOGG(file, info.Size(), meta)
+	case ".wav":
+		err = readWAV(file, info.Size(), meta)
+	case ".m4a":
+		err = readM4A(file, info.Size(), meta)
+	}
+
+	// Keep whatever was parsed before a malformed tag stopped the reader
+	meta.apply(song)
+	return err
+}
+
+func (m *metadata) apply(song *Song) {
+	song.Title = m.fields[tagTitle]
+	song.Artist = m.fields[tagArtist]
+	song.Album = m.fields[tagAlbum]
+	song.AlbumArtist = m.fields[tagAlbumArtist]
+	song.Genre = m.fields[tagGenre]
+	song.TrackNumber = parseNumber(m.fields[tagTrack])
+	song.DiscNumber = parseNumber(m.fields[tagDisc])
+	song.Year = parseYear(m.fields[tagDate])
+	song.Rating = parseRating(m.fields[tagRating])
+	song.TrackGain = parseGain(m.fields[tagTrackGain], m.fields[tagTrackPeak])
+	song.AlbumGain = parseGain(m.fields[tagAlbumGain], m.fields[tagAlbumPeak])
+	song.Duration = m.duration
+}
+
+// parseNumber handles "3", "03" and "3/12" forms
+func parseNumber(value string) int {
+	if i := strings.IndexByte(value, '/'); i >= 0 {
+		value = value[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseRating normalizes 1-5 star and 0-100 percent ratings to stars
+func parseRating(value string) int {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	if n > 5 {
+		n /= 20
+	}
+	return int(math.Max(1, math.Min(5, math.Round(n))))
+}
+
+// parseGain reads ReplayGain values such as "-6.54 dB" and "0.988312"
+func parseGain(gain, peak string) *Gain {
+	value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(gain)), "db"))
+	g, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	p, _ := strconv.ParseFloat(strings.TrimSpace(peak), 64)
+	return &Gain{Gain: g, Peak: math.Max(p, 0)}
+}
+
+// parseYear extracts the year of "2004", "2004-05-01" or "2004-05-01T12:00:00Z"
+func parseYear(value string) int {
+	if len(value) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(value[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
@@ -0,0 +1,233 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+func readFLAC(r io.Reader, meta *metadata) error {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return err
+	}
+
+	// Some taggers prepend an ID3v2 tag to FLAC files
+	if string(marker[:3]) == "ID3" {
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(syncsafe(header[2:6]))); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return err
+		}
+	}
+
+	if string(marker) != "fLaC" {
+		return errors.New("flac: missing stream marker")
+	}
+
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		switch blockType {
+		case 0: // STREAMINFO
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return err
+			}
+			if len(block) >= 18 {
+				sampleRate := int64(block[10])<<12 | int64(block[11])<<4 | int64(block[12])>>4
+				totalSamples := int64(block[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(block[14:18]))
+				if sampleRate > 0 {
+					meta.duration = time.Duration(totalSamples) * time.Second / time.Duration(sampleRate)
+				}
+			}
+		case 4: // VORBIS_COMMENT
+			block := make([]byte, length)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return err
+			}
+			parseVorbisComments(block, meta)
+		default:
+			if _, err := io.CopyN(io.Discard, r, length); err != nil {
+				return err
+			}
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+// parseVorbisComments parses a comment block (without the packet header)
+func parseVorbisComments(data []byte, meta *metadata) {
+	readLength := func() (int, bool) {
+		if len(data) < 4 {
+			return 0, false
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		return n, true
+	}
+
+	vendorLen, ok := readLength()
+	if !ok || vendorLen > len(data) {
+		return
+	}
+	data = data[vendorLen:]
+
+	count, ok := readLength()
+	if !ok {
+		return
+	}
+
+	for i := 0; i < count; i++ {
+		n, ok := readLength()
+		if !ok || n > len(data) {
+			return
+		}
+		comment := string(data[:n])
+		data = data[n:]
+
+		if key, value, found := strings.Cut(comment, "="); found {
+			key = strings.ToLower(key)
+			switch key {
+			case "year":
+				key = tagDate
+			case "album artist":
+				key = tagAlbumArtist
+			case "tracknum":
+				key = tagTrack
+			}
+			meta.set(key, value)
+		}
+	}
+}
+
+// oggReader reassembles packets from the pages of a single logical stream
+type oggReader struct {
+	r      io.ReaderAt
+	offset int64
+
+	// Current page
+	table   []byte
+	body    []byte
+	segment int
+	pos     int
+}
+
+func (o *oggReader) nextPacket() ([]byte, error) {
+	var packet []byte
+
+	for {
+		if o.segment >= len(o.table) {
+			if err := o.readPage(); err != nil {
+				return nil, err
+			}
+		}
+
+		for o.segment < len(o.table) {
+			size := int(o.table[o.segment])
+			packet = append(packet, o.body[o.pos:o.pos+size]...)
+			o.pos += size
+			o.segment++
+			if size < 255 {
+				return packet, nil
+			}
+		}
+
+		if len(packet) > 16<<20 {
+			return nil, errors.New("ogg: packet too large")
+		}
+	}
+}
+
+func (o *oggReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := o.r.ReadAt(header, o.offset); err != nil {
+		return err
+	}
+	if string(header[:4]) != "OggS" {
+		return errors.New("ogg: invalid page header")
+	}
+
+	segments := int(header[26])
+	o.table = make([]byte, segments)
+	if _, err := o.r.ReadAt(o.table, o.offset+27); err != nil {
+		return err
+	}
+
+	var bodySize int
+	for _, size := range o.table {
+		bodySize += int(size)
+	}
+	o.body = make([]byte, bodySize)
+	if _, err := o.r.ReadAt(o.body, o.offset+27+int64(segments)); err != nil {
+		return err
+	}
+
+	o.offset += 27 + int64(segments) + int64(bodySize)
+	o.segment = 0
+	o.pos = 0
+	return nil
+}
+
+func readOGG(r io.ReaderAt, size int64, meta *metadata) error {
+	reader := &oggReader{r: r}
+
+	ident, err := reader.nextPacket()
+	if err != nil {
+		return err
+	}
+	if len(ident) < 16 || !bytes.Equal(ident[:7], []byte("\x01vorbis")) {
+		return errors.New("ogg: not a vorbis stream")
+	}
+	sampleRate := int64(binary.LittleEndian.Uint32(ident[12:16]))
+
+	comments, err := reader.nextPacket()
+	if err != nil {
+		return err
+	}
+	if len(comments) >= 7 && bytes.Equal(comments[:7], []byte("\x03vorbis")) {
+		parseVorbisComments(comments[7:], meta)
+	}
+
+	if granule := lastGranule(r, size); granule > 0 && sampleRate > 0 {
+		meta.duration = time.Duration(granule) * time.Second / time.Duration(sampleRate)
+	}
+
+	return nil
+}
+
+// lastGranule returns the granule position (sample count) of the last page
+func lastGranule(r io.ReaderAt, size int64) int64 {
+	tail := int64(65536)
+	if tail > size {
+		tail = size
+	}
+	buf := make([]byte, tail)
+	if _, err := r.ReadAt(buf, size-tail); err != nil && err != io.EOF {
+		return 0
+	}
+
+	i := bytes.LastIndex(buf, []byte("OggS"))
+	if i < 0 || i+14 > len(buf) {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(buf[i+6 : i+14]))
+}
@@ -0,0 +1,121 @@
+package library
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Bursts of events (e.g. copying an album) are coalesced into a single refresh
+const watchDebounce = 500 * time.Millisecond
+
+// Watcher keeps a Library in sync with the music directories using inotify
+type Watcher struct {
+	library  *Library
+	fsw      *fsnotify.Watcher
+	callback func([]string)
+
+	pending map[string]bool
+	mu      sync.Mutex
+}
+
+func NewWatcher(lib *Library) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		library: lib,
+		fsw:     fsw,
+		pending: make(map[string]bool),
+	}
+
+	for _, root := range lib.Roots() {
+		w.watchTree(root)
+	}
+
+	return w, nil
+}
+
+// SetChangeCallback registers a function called with the refreshed directories
+// after the library has been updated
+func (w *Watcher) SetChangeCallback(callback func([]string)) {
+	w.callback = callback
+}
+
+func (w *Watcher) Start(ctx context.Context) {
+	go w.run(ctx)
+}
+
+func (w *Watcher) watchTree(root string) {
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			// Unwatchable directories (permissions, inotify limits) are skipped
+			w.fsw.Add(path)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	defer w.fsw.Close()
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.watchTree(event.Name)
+				}
+			}
+
+			w.mu.Lock()
+			w.pending[filepath.Dir(event.Name)] = true
+			w.mu.Unlock()
+			timer.Reset(watchDebounce)
+		case <-w.fsw.Errors:
+			// Overflows and similar errors are recovered by the next event
+		case <-timer.C:
+			w.flush()
+		}
+	}
+}
+
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	dirs := make([]string, 0, len(w.pending))
+	for dir := range w.pending {
+		dirs = append(dirs, dir)
+	}
+	w.pending = make(map[string]bool)
+	w.mu.Unlock()
+
+	for _, dir := range dirs {
+		w.library.Refresh(dir)
+	}
+
+	if w.callback != nil && len(dirs) > 0 {
+		w.callback(dirs)
+	}
+}
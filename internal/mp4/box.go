@@ -0,0 +1,123 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxBoxData bounds the payload ReadData loads into memory
+const maxBoxData = 64 << 20
+
+// Box is a box (atom) of an MP4/M4A file
+type Box struct {
+	Type   string
+	Offset int64 // start of the payload
+	Size   int64 // size of the payload
+}
+
+// End returns the offset just past the box
+func (b Box) End() int64 {
+	return b.Offset + b.Size
+}
+
+func readHeader(r io.ReaderAt, offset, end int64) (Box, error) {
+	var hdr [16]byte
+	if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+		return Box{}, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(hdr[0:4]))
+	kind := string(hdr[4:8])
+	headerLen := int64(8)
+
+	switch size {
+	case 0:
+		size = end - offset
+	case 1:
+		if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+			return Box{}, err
+		}
+		size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		headerLen = 16
+	}
+
+	// Compared as remaining space so huge 64-bit sizes can't overflow
+	if size < headerLen || size > end-offset {
+		return Box{}, fmt.Errorf("mp4: invalid %q box size %d", kind, size)
+	}
+
+	return Box{Type: kind, Offset: offset + headerLen, Size: size - headerLen}, nil
+}
+
+// ReadBoxes returns the boxes in the region [offset, offset+size). On an
+// invalid box it returns those before it along with the error.
+func ReadBoxes(r io.ReaderAt, offset, size int64) ([]Box, error) {
+	var boxes []Box
+	end := offset + size
+
+	for offset+8 <= end {
+		box, err := readHeader(r, offset, end)
+		if err != nil {
+			return boxes, err
+		}
+		boxes = append(boxes, box)
+		offset = box.End()
+	}
+
+	return boxes, nil
+}
+
+// Children returns the boxes inside box, skipping the version and flags of
+// full boxes that have children such as meta
+func Children(r io.ReaderAt, box Box) ([]Box, error) {
+	if box.Type == "meta" {
+		if box.Size < 4 {
+			return nil, fmt.Errorf("mp4: truncated %q box", box.Type)
+		}
+		return ReadBoxes(r, box.Offset+4, box.Size-4)
+	}
+	return ReadBoxes(r, box.Offset, box.Size)
+}
+
+// Find returns the first box of type kind
+func Find(boxes []Box, kind string) (Box, bool) {
+	for _, box := range boxes {
+		if box.Type == kind {
+			return box, true
+		}
+	}
+	return Box{}, false
+}
+
+// FindPath walks nested boxes, e.g. FindPath(r, boxes, "mdia", "minf", "stbl")
+func FindPath(r io.ReaderAt, boxes []Box, path ...string) (Box, bool) {
+	var box Box
+	for i, kind := range path {
+		var ok bool
+		box, ok = Find(boxes, kind)
+		if !ok {
+			return Box{}, false
+		}
+		if i < len(path)-1 {
+			children, err := Children(r, box)
+			if err != nil && len(children) == 0 {
+				return Box{}, false
+			}
+			boxes = children
+		}
+	}
+	return box, true
+}
+
+// ReadData reads the payload of box
+func ReadData(r io.ReaderAt, box Box) ([]byte, error) {
+	if box.Size > maxBoxData {
+		return nil, fmt.Errorf("mp4: %q box too large", box.Type)
+	}
+	data := make([]byte, box.Size)
+	if _, err := r.ReadAt(data, box.Offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,402 @@
+package mpris
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/sammwyy/listnr/internal/audio"
+	"github.com/sammwyy/listnr/internal/events"
+	"github.com/sammwyy/listnr/internal/library"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	busName     = "org.mpris.MediaPlayer2.listnr"
+	objectPath  = "/org/mpris/MediaPlayer2"
+	rootIface   = "org.mpris.MediaPlayer2"
+	playerIface = "org.mpris.MediaPlayer2.Player"
+	propsIface  = "org.freedesktop.DBus.Properties"
+
+	// trackPrefix starts the object paths identifying songs
+	trackPrefix = "/org/sammwyy/listnr/track/"
+)
+
+var mimeTypes = []string{"audio/mpeg", "audio/flac", "audio/ogg", "audio/wav", "audio/x-wav", "audio/mp4"}
+
+// Controller is the part of the UI the media controls drive: the queue and
+// quitting. The UI implements it, tests can stand in for it.
+type Controller interface {
+	// QueueUpdateDraw runs f on the UI goroutine, where the other methods
+	// must be called. It returns false without running f once the UI stopped.
+	QueueUpdateDraw(f func()) bool
+	NextSong()
+	PreviousSong()
+	Enqueue(songs []*library.Song, next bool)
+	Stop()
+}
+
+// Server exposes the player as an MPRIS 2 media player, so desktop media
+// keys, widgets and playerctl can control it
+type Server struct {
+	conn    *dbus.Conn
+	player  *audio.Player
+	app     Controller
+	library *library.Library
+}
+
+// New exports the player on conn, usually the session bus, and claims its
+// bus name. When another listnr holds the name, an instance-specific one is
+// used as the spec asks.
+func New(conn *dbus.Conn, player *audio.Player, app Controller, lib *library.Library) (*Server, error) {
+	s := &Server{conn: conn, player: player, app: app, library: lib}
+
+	exports := []struct {
+		value   interface{}
+		iface   string
+		methods map[string]string // Go method names to D-Bus ones that differ
+	}{
+		{rootObject{s}, rootIface, nil},
+		{playerObject{s}, playerIface, map[string]string{"SeekBy": "Seek"}},
+		{properties{s}, propsIface, nil},
+		{introspect.Introspectable(introspection), "org.freedesktop.DBus.Introspectable", nil},
+	}
+	for _, export := range exports {
+		if err := conn.ExportWithMap(export.value, export.methods, objectPath, export.iface); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.RequestName(busName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		name := fmt.Sprintf("%s.instance%d", busName, os.Getpid())
+		if _, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Run signals player changes on the bus until ctx is done
+func (s *Server) Run(ctx context.Context) {
+	bus := s.player.EventBus()
+	songCh := bus.Subscribe(events.SongChanged)
+	resumedCh := bus.Subscribe(events.PlaybackResumed)
+	pausedCh := bus.Subscribe(events.PlaybackPaused)
+	volumeCh := bus.Subscribe(events.VolumeChanged)
+	rateCh := bus.Subscribe(events.RateChanged)
+	seekedCh := bus.Subscribe(events.Seeked)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-songCh:
+			s.propertiesChanged("Metadata", "PlaybackStatus", "CanSeek")
+			// Songs resumed partway don't start at 0 as clients assume
+			if position := s.player.Position(); position > 0 {
+				s.seeked(position)
+			}
+		case <-resumedCh:
+			s.propertiesChanged("PlaybackStatus")
+		case <-pausedCh:
+			s.propertiesChanged("PlaybackStatus")
+		case <-volumeCh:
+			s.propertiesChanged("Volume")
+		case <-rateCh:
+			s.propertiesChanged("Rate")
+		case event := <-seekedCh:
+			if data, ok := event.Data.(events.SeekData); ok {
+				s.seeked(data.Position)
+			}
+		}
+	}
+}
+
+// propertiesChanged emits the current values of Player properties
+func (s *Server) propertiesChanged(names ...string) {
+	all := s.playerProperties()
+	changed := make(map[string]dbus.Variant, len(names))
+	for _, name := range names {
+		changed[name] = all[name]
+	}
+	s.conn.Emit(objectPath, propsIface+".PropertiesChanged", playerIface, changed, []string{})
+}
+
+func (s *Server) seeked(position time.Duration) {
+	s.conn.Emit(objectPath, playerIface+".Seeked", position.Microseconds())
+}
+
+func (s *Server) rootProperties() map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"CanQuit":             dbus.MakeVariant(true),
+		"CanRaise":            dbus.MakeVariant(false),
+		"HasTrackList":        dbus.MakeVariant(false),
+		"Identity":            dbus.MakeVariant("listnr"),
+		"SupportedUriSchemes": dbus.MakeVariant([]string{"file"}),
+		"SupportedMimeTypes":  dbus.MakeVariant(mimeTypes),
+	}
+}
+
+func (s *Server) playerProperties() map[string]dbus.Variant {
+	song := s.player.CurrentSong()
+	rate, _ := s.player.Rate()
+
+	volume := s.player.Volume()
+	if s.player.Muted() {
+		volume = 0
+	}
+
+	return map[string]dbus.Variant{
+		"PlaybackStatus": dbus.MakeVariant(s.playbackStatus(song)),
+		"Rate":           dbus.MakeVariant(rate),
+		"Metadata":       dbus.MakeVariant(s.metadata(song)),
+		"Volume":         dbus.MakeVariant(volume),
+		"Position":       dbus.MakeVariant(s.player.Position().Microseconds()),
+		"MinimumRate":    dbus.MakeVariant(audio.MinRate),
+		"MaximumRate":    dbus.MakeVariant(audio.MaxRate),
+		"CanGoNext":      dbus.MakeVariant(true),
+		"CanGoPrevious":  dbus.MakeVariant(true),
+		"CanPlay":        dbus.MakeVariant(true),
+		"CanPause":       dbus.MakeVariant(true),
+		"CanSeek":        dbus.MakeVariant(song != nil),
+		"CanControl":     dbus.MakeVariant(true),
+	}
+}
+
+func (s *Server) playbackStatus(song *library.Song) string {
+	switch {
+	case song == nil:
+		return "Stopped"
+	case s.player.IsPlaying():
+		return "Playing"
+	default:
+		return "Paused"
+	}
+}
+
+func (s *Server) metadata(song *library.Song) map[string]dbus.Variant {
+	// Clients clear what they show on empty metadata
+	if song == nil {
+		return map[string]dbus.Variant{}
+	}
+
+	length := s.player.Duration()
+	if length == 0 {
+		length = song.Duration
+	}
+	fileURL := url.URL{Scheme: "file", Path: song.Path}
+
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid":  dbus.MakeVariant(trackID(song)),
+		"mpris:length":   dbus.MakeVariant(length.Microseconds()),
+		"xesam:title":    dbus.MakeVariant(song.DisplayName()),
+		"xesam:url":      dbus.MakeVariant(fileURL.String()),
+		"xesam:useCount": dbus.MakeVariant(int32(song.PlayCount())),
+	}
+	if song.Artist != "" {
+		metadata["xesam:artist"] = dbus.MakeVariant([]string{song.Artist})
+	}
+	if song.AlbumArtist != "" {
+		metadata["xesam:albumArtist"] = dbus.MakeVariant([]string{song.AlbumArtist})
+	}
+	if song.Album != "" {
+		metadata["xesam:album"] = dbus.MakeVariant(song.Album)
+	}
+	if song.Genre != "" {
+		metadata["xesam:genre"] = dbus.MakeVariant([]string{song.Genre})
+	}
+	if song.TrackNumber > 0 {
+		metadata["xesam:trackNumber"] = dbus.MakeVariant(int32(song.TrackNumber))
+	}
+	if song.DiscNumber > 0 {
+		metadata["xesam:discNumber"] = dbus.MakeVariant(int32(song.DiscNumber))
+	}
+	if song.Year > 0 {
+		metadata["xesam:contentCreated"] = dbus.MakeVariant(fmt.Sprintf("%04d", song.Year))
+	}
+	if song.Rating > 0 {
+		metadata["xesam:userRating"] = dbus.MakeVariant(float64(song.Rating) / 5)
+	}
+	return metadata
+}
+
+// update runs f on the UI goroutine, failing the call once the UI stopped
+func (s *Server) update(f func()) *dbus.Error {
+	if !s.app.QueueUpdateDraw(f) {
+		return dbus.MakeFailedError(errors.New("listnr is shutting down"))
+	}
+	return nil
+}
+
+// trackID derives a stable object path from the song's file
+func trackID(song *library.Song) dbus.ObjectPath {
+	hash := fnv.New64a()
+	hash.Write([]byte(song.Path))
+	return dbus.ObjectPath(fmt.Sprintf("%s%016x", trackPrefix, hash.Sum64()))
+}
+
+// rootObject implements org.mpris.MediaPlayer2
+type rootObject struct {
+	s *Server
+}
+
+// Raise does nothing, a terminal can't be brought to the front
+func (r rootObject) Raise() *dbus.Error {
+	return nil
+}
+
+func (r rootObject) Quit() *dbus.Error {
+	r.s.app.Stop()
+	return nil
+}
+
+// playerObject implements org.mpris.MediaPlayer2.Player
+type playerObject struct {
+	s *Server
+}
+
+func (p playerObject) Next() *dbus.Error {
+	return p.s.update(p.s.app.NextSong)
+}
+
+func (p playerObject) Previous() *dbus.Error {
+	return p.s.update(p.s.app.PreviousSong)
+}
+
+func (p playerObject) Pause() *dbus.Error {
+	p.s.player.SetPaused(true)
+	return nil
+}
+
+func (p playerObject) PlayPause() *dbus.Error {
+	p.s.player.TogglePlayPause()
+	return nil
+}
+
+func (p playerObject) Stop() *dbus.Error {
+	p.s.player.Stop()
+	return nil
+}
+
+func (p playerObject) Play() *dbus.Error {
+	p.s.player.SetPaused(false)
+	return nil
+}
+
+// SeekBy implements Seek, moving by offset microseconds and going to the next
+// song when seeking past the end. The Go name keeps vet from taking it for
+// io.Seeker.
+func (p playerObject) SeekBy(offset int64) *dbus.Error {
+	player := p.s.player
+	if player.CurrentSong() == nil {
+		return nil
+	}
+
+	position := player.Position() + time.Duration(offset)*time.Microsecond
+	if position >= player.Duration() {
+		return p.s.update(p.s.app.NextSong)
+	}
+	player.SeekTo(position)
+	return nil
+}
+
+// SetPosition seeks to position microseconds, ignored unless track is
+// still the current song and position lies within it
+func (p playerObject) SetPosition(track dbus.ObjectPath, position int64) *dbus.Error {
+	player := p.s.player
+	song := player.CurrentSong()
+	if song == nil || track != trackID(song) {
+		return nil
+	}
+
+	target := time.Duration(position) * time.Microsecond
+	if target < 0 || target > player.Duration() {
+		return nil
+	}
+	player.SeekTo(target)
+	return nil
+}
+
+// OpenUri plays a file from the library right away, keeping the rest of
+// the queue after it
+func (p playerObject) OpenUri(uri string) *dbus.Error {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return dbus.MakeFailedError(fmt.Errorf("unsupported uri %q", uri))
+	}
+	song, _ := p.s.library.FindSong(parsed.Path)
+	if song == nil {
+		return dbus.MakeFailedError(fmt.Errorf("%s is not in the library", parsed.Path))
+	}
+
+	app := p.s.app
+	return p.s.update(func() {
+		app.Enqueue([]*library.Song{song}, true)
+		app.NextSong()
+	})
+}
+
+// properties implements org.freedesktop.DBus.Properties, reading values
+// from the player on every call
+type properties struct {
+	s *Server
+}
+
+func (p properties) all(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	switch iface {
+	case rootIface:
+		return p.s.rootProperties(), nil
+	case playerIface:
+		return p.s.playerProperties(), nil
+	}
+	return nil, dbus.NewError("org.freedesktop.DBus.Error.UnknownInterface", []interface{}{iface})
+}
+
+func (p properties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	all, err := p.all(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	value, ok := all[name]
+	if !ok {
+		return dbus.Variant{}, dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []interface{}{name})
+	}
+	return value, nil
+}
+
+func (p properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return p.all(iface)
+}
+
+func (p properties) Set(iface, name string, value dbus.Variant) *dbus.Error {
+	if iface != playerIface || (name != "Volume" && name != "Rate") {
+		return dbus.NewError("org.freedesktop.DBus.Error.PropertyReadOnly", []interface{}{name})
+	}
+	level, ok := value.Value().(float64)
+	if !ok || math.IsNaN(level) {
+		return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []interface{}{name})
+	}
+
+	// The player clamps both and reports the result through the event bus
+	switch {
+	case name == "Volume":
+		p.s.player.SetVolume(level)
+	case level <= 0:
+		// The spec treats a rate of 0 as pausing
+		p.s.player.SetPaused(true)
+	default:
+		p.s.player.SetRate(level)
+	}
+	return nil
+}
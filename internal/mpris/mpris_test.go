@@ -0,0 +1,227 @@
+package mpris
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sammwyy/listnr/internal/audio"
+	"github.com/sammwyy/listnr/internal/config"
+	"github.com/sammwyy/listnr/internal/library"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeController runs UI updates right away, there is no UI goroutine
+type fakeController struct{}
+
+func (fakeController) QueueUpdateDraw(f func()) bool            { f(); return true }
+func (fakeController) NextSong()                                {}
+func (fakeController) PreviousSong()                            {}
+func (fakeController) Enqueue(songs []*library.Song, next bool) {}
+func (fakeController) Stop()                                    {}
+
+// startBus runs a private session bus and returns its address
+func startBus(t *testing.T) string {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	cmd := exec.Command(daemon, "--session", "--print-address", "--nofork")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal("reading the bus address:", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// writeWAV writes seconds of silence as 16-bit mono PCM
+func writeWAV(t *testing.T, seconds int) string {
+	t.Helper()
+
+	const sampleRate = 44100
+	data := make([]byte, seconds*sampleRate*2)
+
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 1) // channels
+	binary.LittleEndian.PutUint32(header[24:], sampleRate)
+	binary.LittleEndian.PutUint32(header[28:], sampleRate*2)
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+
+	path := filepath.Join(t.TempDir(), "silence.wav")
+	if err := os.WriteFile(path, append(header, data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// waitSignal returns the first signal named name that match accepts
+func waitSignal(t *testing.T, signals <-chan *dbus.Signal, name string, match func(*dbus.Signal) bool) *dbus.Signal {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Name == name && match(signal) {
+				return signal
+			}
+		case <-timeout:
+			t.Fatalf("no %s signal", name)
+		}
+	}
+}
+
+// changed reports whether a PropertiesChanged signal includes property
+func changed(property string) func(*dbus.Signal) bool {
+	return func(signal *dbus.Signal) bool {
+		if len(signal.Body) < 2 {
+			return false
+		}
+		values, ok := signal.Body[1].(map[string]dbus.Variant)
+		if !ok {
+			return false
+		}
+		_, ok = values[property]
+		return ok
+	}
+}
+
+func getProperty(t *testing.T, object dbus.BusObject, name string) interface{} {
+	t.Helper()
+
+	value, err := object.GetProperty(playerIface + "." + name)
+	if err != nil {
+		t.Fatalf("getting %s: %v", name, err)
+	}
+	return value.Value()
+}
+
+func TestServer(t *testing.T) {
+	address := startBus(t)
+	serverConn := connect(t, address)
+	clientConn := connect(t, address)
+
+	sink, err := audio.OpenSink(audio.SinkOptions{Type: audio.SinkNull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	player := audio.NewPlayer(sink, &config.Config{})
+	player.Start(ctx)
+
+	server, err := New(serverConn, player, fakeController{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Run(ctx)
+
+	if err := clientConn.AddMatchSignal(dbus.WithMatchObjectPath(objectPath)); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 32)
+	clientConn.Signal(signals)
+
+	object := clientConn.Object(busName, objectPath)
+
+	if status := getProperty(t, object, "PlaybackStatus"); status != "Stopped" {
+		t.Errorf("PlaybackStatus before playing = %v, want Stopped", status)
+	}
+
+	song := &library.Song{Path: writeWAV(t, 5), Name: "silence.wav", Title: "Silence", Artist: "Nobody"}
+	player.Play(song)
+	waitSignal(t, signals, propsIface+".PropertiesChanged", changed("Metadata"))
+
+	if status := getProperty(t, object, "PlaybackStatus"); status != "Playing" {
+		t.Errorf("PlaybackStatus while playing = %v, want Playing", status)
+	}
+	metadata, _ := getProperty(t, object, "Metadata").(map[string]dbus.Variant)
+	if id := metadata["mpris:trackid"].Value(); id != trackID(song) {
+		t.Errorf("mpris:trackid = %v, want %v", id, trackID(song))
+	}
+	if title := metadata["xesam:title"].Value(); title != "Silence" {
+		t.Errorf("xesam:title = %v, want Silence", title)
+	}
+	if length, _ := metadata["mpris:length"].Value().(int64); length != (5 * time.Second).Microseconds() {
+		t.Errorf("mpris:length = %v, want 5s", length)
+	}
+
+	t.Run("volume", func(t *testing.T) {
+		if err := object.SetProperty(playerIface+".Volume", dbus.MakeVariant(0.25)); err != nil {
+			t.Fatal(err)
+		}
+		waitSignal(t, signals, propsIface+".PropertiesChanged", changed("Volume"))
+		if volume, _ := getProperty(t, object, "Volume").(float64); math.Abs(volume-0.25) > 1e-9 {
+			t.Errorf("Volume = %v, want 0.25", volume)
+		}
+	})
+
+	t.Run("seeked", func(t *testing.T) {
+		player.SeekTo(2 * time.Second)
+		signal := waitSignal(t, signals, playerIface+".Seeked", func(*dbus.Signal) bool { return true })
+		position, _ := signal.Body[0].(int64)
+		if position != (2 * time.Second).Microseconds() {
+			t.Errorf("Seeked position = %d, want 2s", position)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		player.Stop()
+		signal := waitSignal(t, signals, propsIface+".PropertiesChanged", changed("Metadata"))
+		values := signal.Body[1].(map[string]dbus.Variant)
+		if metadata, _ := values["Metadata"].Value().(map[string]dbus.Variant); len(metadata) != 0 {
+			t.Errorf("Metadata signaled on stop = %v, want it empty", metadata)
+		}
+		if status := values["PlaybackStatus"].Value(); status != "Stopped" {
+			t.Errorf("PlaybackStatus signaled on stop = %v, want Stopped", status)
+		}
+		if metadata, _ := getProperty(t, object, "Metadata").(map[string]dbus.Variant); len(metadata) != 0 {
+			t.Errorf("Metadata after stop = %v, want it empty", metadata)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package timefmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsePosition parses a position written as seconds, mm:ss or h:mm:ss
+func ParsePosition(text string) (time.Duration, bool) {
+	parts := strings.Split(strings.TrimSpace(text), ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+
+	var position time.Duration
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, false
+		}
+		// Only the leading field may exceed 59, so 90 or 90:00 work too
+		if i > 0 && value > 59 {
+			return 0, false
+		}
+		position = position*60 + time.Duration(value)*time.Second
+	}
+	return position, true
+}
+
+// Format writes d as m:ss, or h:mm:ss from an hour on
+func Format(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
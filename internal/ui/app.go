@@ -2,7 +2,10 @@ package ui
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sammwyy/listnr/internal/audio"
 	"github.com/sammwyy/listnr/internal/config"
@@ -13,6 +16,12 @@ import (
 	"github.com/rivo/tview"
 )
 
+// How long messages stay on the status line
+const statusDuration = 5 * time.Second
+
+// How often the session is saved while running, so a crash loses little
+const sessionInterval = 30 * time.Second
+
 type App struct {
 	// Core components
 	tviewApp *tview.Application
@@ -21,22 +30,30 @@ type App struct {
 	config   *config.Config
 
 	// UI state
-	selectedSong    int
 	currentDir      *library.Directory
+	queue           *library.Queue
+	focus           pane
 	autoplayEnabled bool
-	repeatMode      bool
+	repeatMode      config.RepeatMode
+	skipFailures    int // unplayable songs skipped in a row
 
 	// UI components
 	sidebar    *components.Sidebar
 	songList   *components.SongList
+	queueList  *components.QueueList
 	controls   *components.Controls
 	visualizer *components.Visualizer
+	equalizer  *components.Equalizer
+	seekPrompt *components.SeekPrompt
+	statusLine *components.StatusLine
 	layout     *tview.Flex
+	pages      *tview.Pages
 
 	// Event handling
 	ctx        context.Context
 	cancel     context.CancelFunc
 	keyHandler *KeyHandler
+	stopped    chan struct{} // closed once the UI no longer runs updates
 
 	// Synchronization
 	mu sync.RWMutex
@@ -47,11 +64,13 @@ func NewApp(cfg *config.Config, player *audio.Player, lib *library.Library) *App
 		tviewApp:        tview.NewApplication(),
 		player:          player,
 		library:         lib,
-		selectedSong:    0,
-		autoplayEnabled: true,
-		repeatMode:      false,
+		queue:           library.NewQueue(),
+		autoplayEnabled: cfg.AutoplayEnabled,
+		repeatMode:      cfg.RepeatMode,
 		config:          cfg,
+		stopped:         make(chan struct{}),
 	}
+	app.queue.SetShuffle(library.ShuffleMode(cfg.ShuffleMode))
 
 	app.keyHandler = NewKeyHandler(app, player)
 	return app
@@ -63,18 +82,41 @@ func (a *App) Start(ctx context.Context) error {
 
 	// Start audio player
 	a.player.Start(a.ctx)
+	a.updateAlbumContext()
 
 	// Setup UI
 	a.setupUI()
 
 	// Setup event handlers
-	go a.handlePlayerEvents()
+	subscribed := make(chan struct{})
+	go a.handlePlayerEvents(subscribed)
+	<-subscribed
+
+	// Pick up where the last run left off
+	a.restoreSession()
+	stopSaving, savingDone := make(chan struct{}), make(chan struct{})
+	go a.saveSessionPeriodically(stopSaving, savingDone)
+
+	// Watch music directories for changes
+	a.startWatcher()
+
+	if a.config.AnalyzeInBackground {
+		// Results only matter to songs played later, so errors are ignored
+		go a.library.AnalyzeLoudness(a.ctx, audio.MeasureLoudness, false, nil)
+	}
 
 	// Setup keybindings
 	a.keyHandler.Setup()
 
 	// Start TUI
-	return a.tviewApp.SetRoot(a.layout, true).EnableMouse(true).Run()
+	err := a.tviewApp.SetRoot(a.pages, true).EnableMouse(true).Run()
+	close(a.stopped)
+
+	// Let a periodic save in progress finish before the final one
+	close(stopSaving)
+	<-savingDone
+	a.saveSession()
+	return err
 }
 
 func (a *App) Stop() {
@@ -93,24 +135,37 @@ func (a *App) setupUI() {
 	// Initialize components
 	a.sidebar = components.NewSidebar()
 	a.songList = components.NewSongList()
+	a.queueList = components.NewQueueList()
 	a.controls = components.NewControls()
 	a.visualizer = components.NewVisualizer()
+	a.equalizer = components.NewEqualizer(audio.EqualizerFrequencies, audio.EqualizerMaxGain)
+	a.seekPrompt = components.NewSeekPrompt()
+	a.statusLine = components.NewStatusLine()
 
 	// Sync data
 	a.controls.SetAutoplay(a.autoplayEnabled)
-	a.controls.SetRepeatMode(a.repeatMode)
+	a.controls.SetRepeatMode(string(a.repeatMode))
+	a.controls.SetShuffleMode(string(a.queue.Shuffle()))
+	a.controls.SetVolume(a.player.Volume(), a.player.Muted())
+	a.controls.SetRate(a.player.Rate())
 
 	// Setup component callbacks
 	a.sidebar.SetSelectionCallback(a.onDirectorySelected)
 	a.songList.SetSelectionCallback(a.onSongSelected)
+	a.queueList.SetSelectionCallback(a.onQueueItemSelected)
+	a.equalizer.SetChangeCallback(a.onEqualizerChanged)
+	a.controls.SetSeekCallback(a.player.SeekFraction)
+	a.seekPrompt.SetSubmitCallback(a.player.SeekTo)
+	a.seekPrompt.SetCloseCallback(a.hideSeekPrompt)
 
 	// Populate data
 	a.populateLibrary()
 
-	// Layout setup - Two column layout for the top and bottom section
+	// Layout setup - Three columns on top, two on the bottom section
 	topLayout := tview.NewFlex().SetDirection(tview.FlexColumn).
-		AddItem(a.sidebar.List, 0, 1, true).  // Up left
-		AddItem(a.songList.List, 0, 3, false) // Up right
+		AddItem(a.sidebar.List, 0, 1, true).   // Up left
+		AddItem(a.songList.List, 0, 2, false). // Up center
+		AddItem(a.queueList.List, 0, 1, false) // Up right
 
 	bottomLayout := tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(a.visualizer.TextView, 0, 1, false). // Down left
@@ -118,11 +173,37 @@ func (a *App) setupUI() {
 
 	// Main layout
 	a.layout = tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(topLayout, 0, 1, true).    // Top section takes remaining space
-		AddItem(bottomLayout, 4, 0, false) // Controls fixed at 4 lines
+		AddItem(topLayout, 0, 1, true).             // Top section takes remaining space
+		AddItem(bottomLayout, 4, 0, false).         // Controls fixed at 4 lines
+		AddItem(a.statusLine.TextView, 0, 0, false) // Status line, only while showing a message
+
+	// Equalizer panel, shown centered above the main layout
+	a.equalizer.SetGains(a.config.EqualizerGains, a.config.Equalizer)
+	width, height := a.equalizer.Size()
+	equalizerPanel := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(a.equalizer.TextView, height, 0, false).
+			AddItem(nil, 0, 1, false), width, 0, false).
+		AddItem(nil, 0, 1, false)
+
+	// Seek prompt, centered like the equalizer
+	seekPanel := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(a.seekPrompt.InputField, 3, 0, true).
+			AddItem(nil, 0, 1, false), 24, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	a.pages = tview.NewPages().
+		AddPage("main", a.layout, true, true).
+		AddPage("equalizer", equalizerPanel, true, false).
+		AddPage("seek", seekPanel, true, false)
 
 	// Set initial focus
-	a.FocusLeft()
+	a.setFocus(paneSidebar)
 }
 
 func (a *App) populateLibrary() {
@@ -135,31 +216,287 @@ func (a *App) populateLibrary() {
 	}
 }
 
+// restoreSession brings back the directory, queue and song of the last run,
+// the song paused where it was left
+func (a *App) restoreSession() {
+	if a.config.LastPath != "" {
+		if dir := a.library.FindDirectory(a.config.LastPath); dir != nil {
+			a.mu.Lock()
+			a.currentDir = dir
+			a.mu.Unlock()
+
+			a.sidebar.SelectDirectory(dir.Path)
+			a.songList.SetDirectory(dir)
+		}
+	}
+
+	session := config.LoadSession()
+	songs, current := a.findSongs(session.Queue, session.Current)
+	original, _ := a.findSongs(session.Original, -1)
+	a.queue.Restore(songs, original, current)
+
+	if a.config.ResumePlayback && session.Song != "" {
+		if song, _ := a.library.FindSong(session.Song); song != nil {
+			a.player.Cue(song, session.Position)
+		}
+	}
+
+	// After cueing, as the player only preloads behind a loaded song
+	a.refreshQueue()
+}
+
+// findSongs maps saved paths back to songs, skipping those no longer in the
+// library. index is moved along, -1 if its song is gone.
+func (a *App) findSongs(paths []string, index int) ([]*library.Song, int) {
+	var songs []*library.Song
+	found := -1
+	for i, path := range paths {
+		song, _ := a.library.FindSong(path)
+		if song == nil {
+			continue
+		}
+		if i == index {
+			found = len(songs)
+		}
+		songs = append(songs, song)
+	}
+	return songs, found
+}
+
+// saveSession stores the playback session and writes the settings changed
+// while running back to the configuration file
+func (a *App) saveSession() {
+	session := &config.Session{Current: -1}
+	if song := a.player.CurrentSong(); song != nil {
+		session.Song = song.Path
+		session.Position = a.player.Position()
+	}
+	songs, original, current := a.queue.Snapshot()
+	session.Queue = songPaths(songs)
+	session.Original = songPaths(original)
+	session.Current = current
+	config.SaveSession(session)
+	// Resume positions and loops would otherwise wait for a clean exit
+	a.library.SaveSongData()
+
+	volume := a.player.Volume()
+	rate, rateMode := a.player.Rate()
+
+	a.mu.RLock()
+	var lastPath string
+	if a.currentDir != nil {
+		lastPath = a.currentDir.Path
+	}
+	autoplay, repeat := a.autoplayEnabled, a.repeatMode
+	shuffle := a.config.ShuffleMode
+	equalizer, gains := a.config.Equalizer, a.config.EqualizerGains
+	a.mu.RUnlock()
+
+	config.Update(func(cfg *config.Config) {
+		cfg.Volume = volume
+		cfg.LastPath = lastPath
+		cfg.AutoplayEnabled = autoplay
+		cfg.RepeatMode = repeat
+		cfg.ShuffleMode = shuffle
+		cfg.PlaybackRate = rate
+		cfg.RateMode = rateMode
+		cfg.Equalizer = equalizer
+		cfg.EqualizerGains = gains
+	})
+}
+
+// saveSessionPeriodically saves the session until stop is closed, closing
+// done once it returns
+func (a *App) saveSessionPeriodically(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(sessionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.saveSession()
+		}
+	}
+}
+
+func songPaths(songs []*library.Song) []string {
+	var paths []string
+	for _, song := range songs {
+		paths = append(paths, song.Path)
+	}
+	return paths
+}
+
+func (a *App) startWatcher() {
+	watcher, err := library.NewWatcher(a.library)
+	if err != nil {
+		// Without inotify the library is only updated on restart
+		return
+	}
+
+	watcher.SetChangeCallback(func(dirs []string) {
+		a.player.EventBus().Publish(events.Event{
+			Type: events.LibraryChanged,
+			Data: events.LibraryChangedData{Directories: dirs},
+		})
+	})
+	watcher.Start(a.ctx)
+}
+
+// refreshLibrary updates the sidebar and song list after the library changed on disk
+func (a *App) refreshLibrary() {
+	directories := a.library.GetDirectories()
+	a.sidebar.SetDirectories(directories)
+
+	// Rescans replace directories, so the one shown is looked up again
+	a.mu.Lock()
+	if a.currentDir != nil {
+		if dir := a.library.FindDirectory(a.currentDir.Path); dir != nil {
+			a.currentDir = dir
+		} else {
+			// The directory being shown was removed
+			a.currentDir = nil
+			if len(directories) > 0 {
+				a.currentDir = directories[0]
+			}
+		}
+	}
+	currentDir := a.currentDir
+	a.mu.Unlock()
+
+	if shown := a.songList.Directory(); shown != nil && currentDir != nil && shown.Path == currentDir.Path {
+		a.songList.Update(currentDir)
+	} else {
+		a.songList.SetDirectory(currentDir)
+	}
+}
+
 func (a *App) onDirectorySelected(dir *library.Directory) {
 	a.mu.Lock()
 	a.currentDir = dir
-	a.selectedSong = 0
 	a.mu.Unlock()
 
 	a.songList.SetDirectory(dir)
 }
 
+// onSongSelected starts playing the directory from the chosen song
 func (a *App) onSongSelected(song *library.Song, index int) {
-	a.mu.Lock()
-	a.selectedSong = index
-	a.mu.Unlock()
+	a.mu.RLock()
+	dir := a.currentDir
+	a.mu.RUnlock()
+
+	if dir != nil {
+		a.queue.Replace(dir.Songs, index)
+	} else {
+		a.queue.Replace([]*library.Song{song}, 0)
+	}
+
+	a.playSong(song)
+}
+
+func (a *App) onQueueItemSelected(index int) {
+	a.PlayQueueEntry(index)
+}
 
+// playSong plays a song that is already the queue's current entry. It must
+// run on the UI goroutine.
+func (a *App) playSong(song *library.Song) {
 	a.player.Play(song)
+	a.showPlaying(song)
+}
+
+// skipTo plays a song that is already the queue's current entry, crossfading
+// from the playing one when a manual crossfade is configured
+func (a *App) skipTo(song *library.Song) {
+	a.player.Skip(song)
+	a.showPlaying(song)
+}
+
+// followSong moves the queue to a song the player continued into on its own
+func (a *App) followSong(song *library.Song) {
+	if a.queue.Current() != song && a.queue.Next() != song {
+		for i, s := range a.queue.Songs() {
+			if s == song {
+				a.queue.Jump(i)
+				break
+			}
+		}
+	}
+	a.showPlaying(song)
+}
+
+func (a *App) showPlaying(song *library.Song) {
+	a.library.RecordPlay(song)
+	a.refreshQueue()
+
+	// Follow the playing song in the song list when it is visible
+	if dir := a.songList.Directory(); dir != nil {
+		for i, s := range dir.Songs {
+			if s == song {
+				a.songList.SetCurrentItem(i)
+				break
+			}
+		}
+	}
 }
 
-func (a *App) handlePlayerEvents() {
+func (a *App) refreshQueue() {
+	a.queueList.SetQueue(a.queue.Songs(), a.queue.CurrentIndex())
+	a.preloadNext()
+}
+
+// preloadNext lets the player decode the song that should follow the current
+// one, so the transition is gapless
+func (a *App) preloadNext() {
+	a.player.Preload(a.upcomingSong())
+}
+
+// upcomingSong returns the song handleSongEnded would continue with
+func (a *App) upcomingSong() *library.Song {
+	a.mu.RLock()
+	autoplay := a.autoplayEnabled
+	repeat := a.repeatMode
+	a.mu.RUnlock()
+
+	switch {
+	case repeat == config.RepeatOne:
+		return a.queue.Current()
+	case !autoplay:
+		return nil
+	}
+
+	if song := a.queue.Peek(); song != nil {
+		return song
+	}
+	// A shuffled queue is reshuffled when it wraps, so its first song isn't known yet
+	if repeat == config.RepeatAll && a.queue.Shuffle() == library.ShuffleOff {
+		if songs := a.queue.Songs(); len(songs) > 0 {
+			return songs[0]
+		}
+	}
+	return nil
+}
+
+// handlePlayerEvents updates the UI on player events, closing subscribed once
+// it receives them
+func (a *App) handlePlayerEvents(subscribed chan<- struct{}) {
 	progressCh := a.player.EventBus().Subscribe(events.ProgressUpdated)
 	songCh := a.player.EventBus().Subscribe(events.SongChanged)
 	playbackCh := a.player.EventBus().Subscribe(events.PlaybackResumed)
 	pauseCh := a.player.EventBus().Subscribe(events.PlaybackPaused)
 	volumeCh := a.player.EventBus().Subscribe(events.VolumeChanged)
+	rateCh := a.player.EventBus().Subscribe(events.RateChanged)
+	loopCh := a.player.EventBus().Subscribe(events.LoopChanged)
 	songEndedCh := a.player.EventBus().Subscribe(events.SongEnded)
 	audioCh := a.player.EventBus().Subscribe(events.AudioDataUpdated)
+	libraryCh := a.player.EventBus().Subscribe(events.LibraryChanged)
+	errorCh := a.player.EventBus().Subscribe(events.PlaybackError)
+	close(subscribed)
 
 	for {
 		select {
@@ -167,12 +504,21 @@ func (a *App) handlePlayerEvents() {
 			return
 		case event := <-progressCh:
 			if data, ok := event.Data.(events.ProgressData); ok {
+				changed := a.rememberPosition(data)
 				a.tviewApp.QueueUpdateDraw(func() {
 					a.controls.UpdateProgress(data.Current, data.Total)
+					if changed {
+						a.songList.Refresh()
+					}
 				})
 			}
 		case event := <-songCh:
 			if data, ok := event.Data.(events.SongData); ok {
+				if data.Song != nil {
+					a.mu.Lock()
+					a.skipFailures = 0
+					a.mu.Unlock()
+				}
 				a.tviewApp.QueueUpdateDraw(func() {
 					a.controls.SetCurrentSong(data.Song)
 				})
@@ -192,12 +538,40 @@ func (a *App) handlePlayerEvents() {
 		case event := <-volumeCh:
 			if data, ok := event.Data.(events.VolumeData); ok {
 				a.tviewApp.QueueUpdateDraw(func() {
-					a.controls.SetVolume(data.Level)
+					a.controls.SetVolume(data.Level, data.Muted)
+				})
+			}
+		case event := <-rateCh:
+			if data, ok := event.Data.(events.RateData); ok {
+				a.mu.Lock()
+				a.config.PlaybackRate = data.Rate
+				a.config.RateMode = data.Mode
+				a.mu.Unlock()
+
+				a.tviewApp.QueueUpdateDraw(func() {
+					a.controls.SetRate(data.Rate, data.Mode)
+				})
+			}
+		case event := <-loopCh:
+			if data, ok := event.Data.(events.LoopData); ok {
+				a.saveLoop(data)
+				a.tviewApp.QueueUpdateDraw(func() {
+					a.controls.SetLoop(data.Start, data.End)
 				})
 			}
 		case event := <-songEndedCh:
 			if data, ok := event.Data.(events.SongEndedData); ok {
-				a.handleSongEnded(data.Song)
+				if a.library.FinishResume(data.Song) {
+					a.tviewApp.QueueUpdateDraw(a.songList.Refresh)
+				}
+				if data.Next != nil {
+					// The player already moved on without a gap
+					a.tviewApp.QueueUpdateDraw(func() {
+						a.followSong(data.Next)
+					})
+				} else {
+					a.handleSongEnded(data.Song)
+				}
 			}
 		case event := <-audioCh:
 			if data, ok := event.Data.(events.AudioData); ok {
@@ -205,86 +579,381 @@ func (a *App) handlePlayerEvents() {
 					a.visualizer.UpdateAudioData(data.FrequencyBands, data.Amplitude, data.IsPlaying)
 				})
 			}
+		case <-libraryCh:
+			a.tviewApp.QueueUpdateDraw(a.refreshLibrary)
+		case event := <-errorCh:
+			if data, ok := event.Data.(events.ErrorData); ok {
+				a.handlePlaybackError(data)
+			}
 		}
 	}
 }
 
+// rememberPosition keeps the position of long songs to resume them from,
+// reporting whether the song list needs redrawing
+func (a *App) rememberPosition(data events.ProgressData) bool {
+	min := a.config.ResumeMinDuration()
+	if data.Song == nil || min == 0 || data.Total < min {
+		return false
+	}
+	return a.library.SetResume(data.Song, data.Current, data.Total)
+}
+
+// saveLoop remembers a complete or cleared A-B loop with the song
+func (a *App) saveLoop(data events.LoopData) {
+	switch {
+	case data.Start >= 0 && data.End >= 0:
+		a.library.SetLoop(data.Song, &library.Loop{Start: data.Start, End: data.End})
+	case data.Start < 0 && data.End < 0:
+		a.library.SetLoop(data.Song, nil)
+	}
+}
+
+// handlePlaybackError reports a song that can't be played and, in autoplay,
+// moves on to the next one if configured to
+func (a *App) handlePlaybackError(data events.ErrorData) {
+	message := data.Err.Error()
+	if data.Song != nil {
+		message = fmt.Sprintf("Can't play %s: %v", data.Song.DisplayName(), data.Err)
+	}
+	a.tviewApp.QueueUpdateDraw(func() {
+		a.showError(message)
+	})
+
+	// Decoding errors partway through end the song, which moves on anyway
+	if data.Kind != events.ErrorDecode {
+		return
+	}
+
+	a.mu.Lock()
+	skip := a.autoplayEnabled && a.config.SkipUnplayable && a.skipFailures < a.queue.Len()
+	if skip {
+		a.skipFailures++
+	}
+	a.mu.Unlock()
+
+	// Stop once every song in the queue failed rather than loop forever
+	if skip {
+		a.tviewApp.QueueUpdateDraw(func() {
+			if data.Song == a.queue.Current() {
+				a.NextSong()
+			}
+		})
+	}
+}
+
+// showError shows message on the status line for a few seconds
+func (a *App) showError(message string) {
+	id := a.statusLine.ShowError(message)
+	a.layout.ResizeItem(a.statusLine.TextView, 1, 0)
+
+	time.AfterFunc(statusDuration, func() {
+		a.tviewApp.QueueUpdateDraw(func() {
+			if a.statusLine.Clear(id) {
+				a.layout.ResizeItem(a.statusLine.TextView, 0, 0)
+			}
+		})
+	})
+}
+
 func (a *App) handleSongEnded(song *library.Song) {
 	a.mu.RLock()
 	autoplay := a.autoplayEnabled
 	repeat := a.repeatMode
 	a.mu.RUnlock()
 
-	if repeat {
-		// Repeat if repeat is enabled
+	if repeat == config.RepeatOne {
+		// Repeat the same song
 		a.player.Play(song)
 	} else if autoplay {
 		// Next song if autoplay is enabled
-		a.NextSong()
+		a.tviewApp.QueueUpdateDraw(a.NextSong)
 	}
 }
 
 // Navigation methods
 func (a *App) NextSong() {
+	song := a.queue.Next()
+	if song == nil && a.getRepeatMode() == config.RepeatAll {
+		// Wrap around to the start of the queue, reshuffling if needed
+		song = a.queue.Restart()
+	}
+	if song != nil {
+		a.skipTo(song)
+	}
+}
+
+func (a *App) PreviousSong() {
+	song := a.queue.Previous()
+	if song == nil {
+		if a.getRepeatMode() == config.RepeatAll {
+			// Wrap around to the end of the queue
+			song = a.queue.Jump(a.queue.Len() - 1)
+		} else {
+			// Restart the first song
+			song = a.queue.Current()
+		}
+	}
+	if song != nil {
+		a.skipTo(song)
+	}
+}
+
+func (a *App) getRepeatMode() config.RepeatMode {
 	a.mu.RLock()
-	if a.currentDir == nil || len(a.currentDir.Songs) == 0 {
-		a.mu.RUnlock()
+	defer a.mu.RUnlock()
+	return a.repeatMode
+}
+
+// Queue methods
+func (a *App) EnqueueSelected() {
+	if song := a.songList.SelectedSong(); song != nil {
+		a.Enqueue([]*library.Song{song}, false)
+	}
+}
+
+func (a *App) PlaySelectedNext() {
+	if song := a.songList.SelectedSong(); song != nil {
+		a.Enqueue([]*library.Song{song}, true)
+	}
+}
+
+// Enqueue adds songs to the end of the queue, or right after the current
+// song when next is set
+func (a *App) Enqueue(songs []*library.Song, next bool) {
+	if next {
+		a.queue.PlayNext(songs...)
+	} else {
+		a.queue.Append(songs...)
+	}
+	a.refreshQueue()
+}
+
+// PlayQueueEntry plays the queue entry at index, reporting whether there is one
+func (a *App) PlayQueueEntry(index int) bool {
+	song := a.queue.Jump(index)
+	if song == nil {
+		return false
+	}
+	a.playSong(song)
+	return true
+}
+
+func (a *App) RemoveFromQueue() {
+	a.queue.Remove(a.queueList.GetCurrentItem())
+	a.refreshQueue()
+}
+
+func (a *App) MoveInQueue(offset int) {
+	from := a.queueList.GetCurrentItem()
+	to := from + offset
+	if to < 0 || to >= a.queue.Len() {
 		return
 	}
 
-	newIndex := (a.selectedSong + 1) % len(a.currentDir.Songs)
-	song := a.currentDir.Songs[newIndex]
-	a.mu.RUnlock()
+	a.queue.Move(from, to)
+	a.refreshQueue()
+	a.queueList.SetCurrentItem(to)
+}
+
+func (a *App) ClearQueue() {
+	a.queue.Clear()
+	a.refreshQueue()
+}
+
+func (a *App) Queue() *library.Queue {
+	return a.queue
+}
+
+type pane int
+
+const (
+	paneSidebar pane = iota
+	paneSongs
+	paneQueue
+)
+
+func (a *App) FocusLeft() {
+	if a.focus > paneSidebar {
+		a.setFocus(a.focus - 1)
+	}
+}
+
+func (a *App) FocusRight() {
+	if a.focus < paneQueue {
+		a.setFocus(a.focus + 1)
+	}
+}
 
+func (a *App) setFocus(p pane) {
+	a.focus = p
+	a.sidebar.SetFocused(p == paneSidebar)
+	a.songList.SetFocused(p == paneSongs)
+	a.queueList.SetFocused(p == paneQueue)
+
+	switch p {
+	case paneSidebar:
+		a.tviewApp.SetFocus(a.sidebar.List)
+	case paneSongs:
+		a.tviewApp.SetFocus(a.songList.List)
+	case paneQueue:
+		a.tviewApp.SetFocus(a.queueList.List)
+	}
+}
+
+// Equalizer methods
+func (a *App) ToggleEqualizer() {
+	if name, _ := a.pages.GetFrontPage(); name == "equalizer" {
+		a.pages.HidePage("equalizer")
+		a.setFocus(a.focus)
+	} else {
+		a.pages.ShowPage("equalizer")
+	}
+}
+
+func (a *App) EqualizerVisible() bool {
+	name, _ := a.pages.GetFrontPage()
+	return name == "equalizer"
+}
+
+// Seek prompt methods
+func (a *App) ShowSeekPrompt() {
+	a.seekPrompt.Reset()
+	a.pages.ShowPage("seek")
+	a.tviewApp.SetFocus(a.seekPrompt.InputField)
+}
+
+func (a *App) hideSeekPrompt() {
+	a.pages.HidePage("seek")
+	a.setFocus(a.focus)
+}
+
+func (a *App) SeekPromptVisible() bool {
+	name, _ := a.pages.GetFrontPage()
+	return name == "seek"
+}
+
+func (a *App) onEqualizerChanged(gains []float64) {
 	a.mu.Lock()
-	a.selectedSong = newIndex
+	a.config.Equalizer = "custom"
+	a.config.EqualizerGains = gains
 	a.mu.Unlock()
 
-	a.player.Play(song)
-	a.songList.SetCurrentItem(newIndex)
+	a.player.SetEqualizer(gains)
 }
 
-func (a *App) PreviousSong() {
+// CycleEqualizerPreset switches to the next built-in or user-defined preset
+func (a *App) CycleEqualizerPreset() {
+	names := a.equalizerPresetNames()
+
 	a.mu.RLock()
-	if a.currentDir == nil || len(a.currentDir.Songs) == 0 {
-		a.mu.RUnlock()
-		return
+	current := a.config.Equalizer
+	a.mu.RUnlock()
+
+	next := names[0]
+	for i, name := range names {
+		if name == current {
+			next = names[(i+1)%len(names)]
+			break
+		}
 	}
+	a.applyEqualizerPreset(next)
+}
 
-	newIndex := (a.selectedSong - 1 + len(a.currentDir.Songs)) % len(a.currentDir.Songs)
-	song := a.currentDir.Songs[newIndex]
-	a.mu.RUnlock()
+func (a *App) ResetEqualizer() {
+	a.applyEqualizerPreset("flat")
+}
 
+func (a *App) applyEqualizerPreset(name string) {
 	a.mu.Lock()
-	a.selectedSong = newIndex
+	gains, ok := a.config.EqualizerPresets[name]
+	if !ok {
+		gains = audio.EqualizerPresets[name]
+	}
+	a.config.Equalizer = name
+	a.config.EqualizerGains = gains
 	a.mu.Unlock()
 
-	a.player.Play(song)
-	a.songList.SetCurrentItem(newIndex)
+	a.equalizer.SetGains(gains, name)
+	a.player.SetEqualizer(gains)
 }
 
-func (a *App) FocusLeft() {
-	a.tviewApp.SetFocus(a.sidebar.List)
-	a.sidebar.SetFocused(true)
-	a.songList.SetFocused(false)
-}
+// equalizerPresetNames returns the built-in presets followed by the user's, sorted
+func (a *App) equalizerPresetNames() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 
-func (a *App) FocusRight() {
-	a.tviewApp.SetFocus(a.songList.List)
-	a.sidebar.SetFocused(false)
-	a.songList.SetFocused(true)
+	var custom []string
+	for name := range a.config.EqualizerPresets {
+		if _, builtin := audio.EqualizerPresets[name]; !builtin {
+			custom = append(custom, name)
+		}
+	}
+	sort.Strings(custom)
+	return append(append([]string{}, audio.EqualizerPresetNames...), custom...)
 }
 
 func (a *App) GetTviewApp() *tview.Application {
 	return a.tviewApp
 }
 
+// QueueUpdateDraw runs f on the UI goroutine and redraws. It waits for f,
+// so it must not be called from the UI goroutine. Once the UI has stopped f
+// is dropped and false returned, rather than waiting forever for a UI that
+// is gone, e.g. for remote control requests arriving during shutdown.
+func (a *App) QueueUpdateDraw(f func()) bool {
+	select {
+	case <-a.stopped:
+		return false
+	default:
+	}
+
+	ran := make(chan struct{})
+	// Left waiting if the UI stops first, until the process exits
+	go a.tviewApp.QueueUpdateDraw(func() {
+		f()
+		close(ran)
+	})
+
+	select {
+	case <-ran:
+		return true
+	case <-a.stopped:
+		return false
+	}
+}
+
 // State management
-func (a *App) ToggleRepeatMode() {
+// CycleRepeatMode switches between off, repeat-all and repeat-one
+func (a *App) CycleRepeatMode() {
 	a.mu.Lock()
-	a.repeatMode = !a.repeatMode
+	a.repeatMode = a.repeatMode.Next()
+	a.config.RepeatMode = a.repeatMode
+	mode := a.repeatMode
 	a.mu.Unlock()
-	a.controls.SetRepeatMode(a.repeatMode)
+	a.controls.SetRepeatMode(string(mode))
+	a.preloadNext()
+}
+
+// CycleShuffleMode switches between off, track, album and weighted shuffle
+func (a *App) CycleShuffleMode() {
+	mode := a.queue.Shuffle().Next()
+	a.queue.SetShuffle(mode)
+
+	a.mu.Lock()
+	a.config.ShuffleMode = string(mode)
+	a.mu.Unlock()
+
+	a.controls.SetShuffleMode(string(mode))
+	a.refreshQueue()
+	a.updateAlbumContext()
+}
+
+// updateAlbumContext lets automatic ReplayGain use album gain while albums
+// play in order
+func (a *App) updateAlbumContext() {
+	mode := a.queue.Shuffle()
+	a.player.SetAlbumContext(mode == library.ShuffleOff || mode == library.ShuffleAlbum)
 }
 
 func (a *App) ToggleAutoplay() {
@@ -292,4 +961,5 @@ func (a *App) ToggleAutoplay() {
 	a.autoplayEnabled = !a.autoplayEnabled
 	a.mu.Unlock()
 	a.controls.SetAutoplay(a.autoplayEnabled)
+	a.preloadNext()
 }
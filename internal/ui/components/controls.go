@@ -2,6 +2,7 @@ package components
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -16,10 +17,19 @@ type Controls struct {
 	currentSong     *library.Song
 	isPlaying       bool
 	volume          float64
+	muted           bool
 	position        time.Duration
 	duration        time.Duration
 	autoplayEnabled bool
-	repeatMode      bool
+	repeatMode      string
+	shuffleMode     string
+	rate            float64
+	rateMode        string
+	loopStart       time.Duration // -1 when unset
+	loopEnd         time.Duration // -1 when unset
+	barStart        int           // first progress bar column, from the inner left edge
+	barWidth        int
+	seekCallback    func(float64)
 }
 
 func NewControls() *Controls {
@@ -33,10 +43,15 @@ func NewControls() *Controls {
 	textView.SetDisabled(true)
 
 	controls := &Controls{
-		TextView: textView,
-		volume:   0.5,
+		TextView:  textView,
+		volume:    0.5,
+		rate:      1,
+		loopStart: -1,
+		loopEnd:   -1,
 	}
 
+	textView.SetMouseCapture(controls.handleMouse)
+
 	controls.update()
 	return controls
 }
@@ -51,8 +66,9 @@ func (c *Controls) SetPlaying(playing bool) {
 	c.update()
 }
 
-func (c *Controls) SetVolume(volume float64) {
+func (c *Controls) SetVolume(volume float64, muted bool) {
 	c.volume = volume
+	c.muted = muted
 	c.update()
 }
 
@@ -61,11 +77,51 @@ func (c *Controls) SetAutoplay(enabled bool) {
 	c.update()
 }
 
-func (c *Controls) SetRepeatMode(enabled bool) {
-	c.repeatMode = enabled
+func (c *Controls) SetRepeatMode(mode string) {
+	c.repeatMode = mode
+	c.update()
+}
+
+func (c *Controls) SetShuffleMode(mode string) {
+	c.shuffleMode = mode
+	c.update()
+}
+
+func (c *Controls) SetRate(rate float64, mode string) {
+	c.rate = rate
+	c.rateMode = mode
+	c.update()
+}
+
+// SetLoop shows the A-B loop points on the progress bar, -1 for unset points
+func (c *Controls) SetLoop(start, end time.Duration) {
+	c.loopStart = start
+	c.loopEnd = end
 	c.update()
 }
 
+// SetSeekCallback registers a function called with the fraction of the song
+// clicked on the progress bar
+func (c *Controls) SetSeekCallback(callback func(float64)) {
+	c.seekCallback = callback
+}
+
+func (c *Controls) handleMouse(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+	if action != tview.MouseLeftClick || c.seekCallback == nil || c.duration == 0 {
+		return action, event
+	}
+
+	x, y := event.Position()
+	innerX, innerY, _, _ := c.TextView.GetInnerRect()
+	column := x - innerX - c.barStart
+	if y != innerY || column < 0 || column >= c.barWidth {
+		return action, event
+	}
+
+	c.seekCallback((float64(column) + 0.5) / float64(c.barWidth))
+	return tview.MouseConsumed, nil
+}
+
 func (c *Controls) UpdateProgress(position, duration time.Duration) {
 	c.position = position
 	c.duration = duration
@@ -77,7 +133,10 @@ func (c *Controls) update() {
 	c.TextView.SetText(text)
 
 	if c.currentSong != nil {
-		title := fmt.Sprintf(" %s ", c.currentSong.Name)
+		title := fmt.Sprintf(" %s ", c.currentSong.DisplayName())
+		if c.currentSong.Artist != "" {
+			title = fmt.Sprintf(" %s - %s ", c.currentSong.DisplayName(), c.currentSong.Artist)
+		}
 		c.TextView.SetTitle(title)
 	} else {
 		c.TextView.SetTitle(" <No Playing> ")
@@ -119,14 +178,31 @@ func (c *Controls) getProgressLine() string {
 	if barWidth < 30 {
 		barWidth = 30
 	}
+	c.barStart = len(currentTime) + 1
+	c.barWidth = barWidth
 
 	// Build progress bar
 	filledWidth := int(progress * float64(barWidth))
+	markerA, markerB := c.loopMarker(c.loopStart, barWidth), c.loopMarker(c.loopEnd, barWidth)
 
 	var bar strings.Builder
 	bar.WriteString("[green]")
 
 	for i := 0; i < barWidth; i++ {
+		if i == markerA || i == markerB {
+			marker := "A"
+			if i == markerB {
+				marker = "B"
+			}
+			bar.WriteString("[yellow]" + marker)
+			if i < filledWidth-1 {
+				bar.WriteString("[green]")
+			} else {
+				bar.WriteString("[dim]")
+			}
+			continue
+		}
+
 		if i < filledWidth-1 {
 			bar.WriteString("=")
 		} else if i == filledWidth-1 && progress > 0 {
@@ -143,6 +219,18 @@ func (c *Controls) getProgressLine() string {
 	return fmt.Sprintf("[cyan]%s[-] %s [cyan]%s[-]", currentTime, bar.String(), totalTime)
 }
 
+// loopMarker returns the bar cell of a loop point, or -1
+func (c *Controls) loopMarker(point time.Duration, barWidth int) int {
+	if point < 0 || c.duration == 0 {
+		return -1
+	}
+	cell := int(float64(point) / float64(c.duration) * float64(barWidth))
+	if cell >= barWidth {
+		cell = barWidth - 1
+	}
+	return cell
+}
+
 func (c *Controls) getControlsLine() string {
 	// Player controls
 	var playIcon string
@@ -153,9 +241,12 @@ func (c *Controls) getControlsLine() string {
 	}
 
 	var repeatIcon, autoplayIcon string
-	if c.repeatMode {
+	switch c.repeatMode {
+	case "one":
+		repeatIcon = "[green][🔂 R][-]"
+	case "all":
 		repeatIcon = "[green][🔁 R][-]"
-	} else {
+	default:
 		repeatIcon = "[red][🔁 R][-]"
 	}
 
@@ -165,28 +256,49 @@ func (c *Controls) getControlsLine() string {
 		autoplayIcon = "[red][⏭ N][-]"
 	}
 
-	controls := fmt.Sprintf(" %s %s   [⏮ Q] [⏪ A] [%s SPACE] [⏩ D] [⏭ E]  ",
-		repeatIcon, autoplayIcon, playIcon)
+	var shuffleIcon string
+	if c.shuffleMode == "" || c.shuffleMode == "off" {
+		shuffleIcon = "[red][🔀 Z][-]"
+	} else {
+		shuffleIcon = fmt.Sprintf("[green][🔀 %s Z][-]", c.shuffleMode)
+	}
+
+	// Only shown while not playing at normal speed
+	var rateIcon string
+	if c.rate != 0 && c.rate != 1 {
+		rateIcon = fmt.Sprintf(" [yellow][%.1fx %s T][-]", c.rate, c.rateMode)
+	}
+
+	controls := fmt.Sprintf(" %s %s %s%s   [⏮ Q] [⏪ A] [%s SPACE] [⏩ D] [⏭ E]  ",
+		repeatIcon, shuffleIcon, autoplayIcon, rateIcon, playIcon)
 
 	// Volume bar (10 segments)
-	volumeSegments := int(c.volume * 10)
+	volumeSegments := int(math.Round(c.volume * 10))
+	segmentColor := "magenta"
+	if c.muted {
+		segmentColor = "dim"
+	}
 
 	var volBar strings.Builder
 	volBar.WriteString("[♪ ")
 	for i := 0; i < 10; i++ {
 		if i < volumeSegments {
-			volBar.WriteString("[magenta]■[-]")
+			volBar.WriteString("[" + segmentColor + "]■[-]")
 		} else {
 			volBar.WriteString("[dim]□[-]")
 		}
 	}
-	volBar.WriteString(fmt.Sprintf(" %d%% W/S]", int(c.volume*100)))
+	if c.muted {
+		volBar.WriteString(" [red]mute[-] M]")
+	} else {
+		volBar.WriteString(fmt.Sprintf(" %d%% W/S]", int(math.Round(c.volume*100))))
+	}
 
 	volumeStr := volBar.String()
 
 	// Calculate spacing
-	controlsLen := len(controls) - 6 // Account for color tags
-	volumeLen := 20
+	controlsLen := tview.TaggedStringWidth(controls)
+	volumeLen := tview.TaggedStringWidth(volumeStr)
 	_, totalWidth, _, _ := c.TextView.GetInnerRect()
 
 	spacing := totalWidth - controlsLen - volumeLen
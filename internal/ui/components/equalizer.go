@@ -0,0 +1,155 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	eqStep      = 3.0 // dB per row of the sliders
+	eqBandWidth = 6
+)
+
+type Equalizer struct {
+	TextView       *tview.TextView
+	frequencies    []float64
+	gains          []float64
+	maxGain        float64
+	selected       int
+	preset         string
+	changeCallback func([]float64)
+}
+
+func NewEqualizer(frequencies []float64, maxGain float64) *Equalizer {
+	textView := tview.NewTextView()
+	textView.SetDynamicColors(true).
+		SetScrollable(false).
+		SetWrap(false).
+		SetBorder(true).
+		SetBorderColor(tcell.ColorWhite)
+	textView.SetTextAlign(tview.AlignCenter)
+
+	eq := &Equalizer{
+		TextView:    textView,
+		frequencies: frequencies,
+		gains:       make([]float64, len(frequencies)),
+		maxGain:     maxGain,
+	}
+	eq.update()
+	return eq
+}
+
+// Size returns the width and height the panel needs
+func (eq *Equalizer) Size() (int, int) {
+	rows := int(2*eq.maxGain/eqStep) + 1
+	// Labels, gains, help line and borders
+	return 4 + len(eq.frequencies)*eqBandWidth + 2, rows + 6
+}
+
+func (eq *Equalizer) SetGains(gains []float64, preset string) {
+	eq.gains = make([]float64, len(eq.frequencies))
+	copy(eq.gains, gains)
+	eq.preset = preset
+	eq.update()
+}
+
+// SetChangeCallback registers a function called with the gains after the user adjusts a band
+func (eq *Equalizer) SetChangeCallback(callback func([]float64)) {
+	eq.changeCallback = callback
+}
+
+func (eq *Equalizer) SelectBand(offset int) {
+	eq.selected = (eq.selected + offset + len(eq.gains)) % len(eq.gains)
+	eq.update()
+}
+
+// Adjust changes the selected band by delta dB
+func (eq *Equalizer) Adjust(delta float64) {
+	gain := eq.gains[eq.selected] + delta
+	if gain > eq.maxGain {
+		gain = eq.maxGain
+	}
+	if gain < -eq.maxGain {
+		gain = -eq.maxGain
+	}
+	eq.gains[eq.selected] = gain
+	eq.preset = "custom"
+	eq.update()
+
+	if eq.changeCallback != nil {
+		gains := make([]float64, len(eq.gains))
+		copy(gains, eq.gains)
+		eq.changeCallback(gains)
+	}
+}
+
+func (eq *Equalizer) update() {
+	eq.TextView.SetTitle(fmt.Sprintf(" Equalizer: %s ", eq.preset))
+	eq.TextView.SetText(eq.render())
+}
+
+func (eq *Equalizer) render() string {
+	var sb strings.Builder
+
+	// Sliders from +max down to -max, filled from the 0 dB line to the gain
+	for level := eq.maxGain; level >= -eq.maxGain; level -= eqStep {
+		if level == 0 {
+			sb.WriteString("[dim]  0[-] ")
+		} else {
+			sb.WriteString(fmt.Sprintf("[dim]%+3.0f[-] ", level))
+		}
+
+		for band, gain := range eq.gains {
+			color := "green"
+			if band == eq.selected {
+				color = "yellow"
+			}
+
+			var cell string
+			switch {
+			// Gains fill the rows they are closest to
+			case level > 0 && gain >= level-eqStep/2, level < 0 && gain <= level+eqStep/2:
+				cell = fmt.Sprintf("[%s]████[-]", color)
+			case level == 0:
+				cell = fmt.Sprintf("[%s]────[-]", color)
+			default:
+				cell = "[dim]  · [-]"
+			}
+			sb.WriteString(" " + cell + " ")
+		}
+		sb.WriteString("\n")
+	}
+
+	// Frequency labels and current gains
+	sb.WriteString("    ")
+	for band, freq := range eq.frequencies {
+		label := fmt.Sprintf("%.0f", freq)
+		if freq >= 1000 {
+			label = fmt.Sprintf("%.0fk", freq/1000)
+		}
+		if band == eq.selected {
+			label = "[yellow]" + padCenter(label, eqBandWidth) + "[-]"
+		} else {
+			label = padCenter(label, eqBandWidth)
+		}
+		sb.WriteString(label)
+	}
+	sb.WriteString("\n    ")
+	for _, gain := range eq.gains {
+		sb.WriteString(padCenter(fmt.Sprintf("%+.0f", gain), eqBandWidth))
+	}
+
+	sb.WriteString("\n\n[dim]←/→ band  ↑/↓ gain  P preset  0 flat  G close[-]")
+	return sb.String()
+}
+
+func padCenter(text string, width int) string {
+	if len(text) >= width {
+		return text
+	}
+	left := (width - len(text)) / 2
+	return strings.Repeat(" ", left) + text + strings.Repeat(" ", width-len(text)-left)
+}
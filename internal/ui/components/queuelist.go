@@ -0,0 +1,87 @@
+package components
+
+import (
+	"fmt"
+
+	"github.com/sammwyy/listnr/internal/library"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type QueueList struct {
+	List              *tview.List
+	songs             []*library.Song
+	current           int
+	selectionCallback func(int)
+}
+
+func NewQueueList() *QueueList {
+	list := tview.NewList()
+	list.ShowSecondaryText(false).
+		SetHighlightFullLine(true).
+		SetBorder(true).
+		SetTitle(" Queue ").
+		SetBorderColor(tcell.ColorGray)
+
+	return &QueueList{
+		List:    list,
+		current: -1,
+	}
+}
+
+func (ql *QueueList) SetQueue(songs []*library.Song, current int) {
+	ql.songs = songs
+	ql.current = current
+	ql.populateList()
+}
+
+func (ql *QueueList) SetSelectionCallback(callback func(int)) {
+	ql.selectionCallback = callback
+}
+
+func (ql *QueueList) populateList() {
+	selected := ql.List.GetCurrentItem()
+	ql.List.Clear()
+
+	for i, song := range ql.songs {
+		var displayName string
+		if i == ql.current {
+			displayName = fmt.Sprintf("[green]▶ %s[-]", song.DisplayName())
+		} else {
+			displayName = fmt.Sprintf("  %s", song.DisplayName())
+		}
+		// Capture variables for closure
+		currentIndex := i
+
+		ql.List.AddItem(displayName, "", 0, func() {
+			if ql.selectionCallback != nil {
+				ql.selectionCallback(currentIndex)
+			}
+		})
+	}
+
+	ql.SetCurrentItem(selected)
+	ql.List.SetTitle(fmt.Sprintf(" Queue (%d) ", len(ql.songs)))
+}
+
+func (ql *QueueList) GetCurrentItem() int {
+	return ql.List.GetCurrentItem()
+}
+
+func (ql *QueueList) SetCurrentItem(index int) {
+	if index >= ql.List.GetItemCount() {
+		index = ql.List.GetItemCount() - 1
+	}
+	if index >= 0 {
+		ql.List.SetCurrentItem(index)
+	}
+}
+
+func (ql *QueueList) SetFocused(focused bool) {
+	if focused {
+		ql.List.SetBorderColor(tcell.ColorWhite)
+	} else {
+		ql.List.SetBorderColor(tcell.ColorGray)
+	}
+}
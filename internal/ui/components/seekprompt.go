@@ -0,0 +1,68 @@
+package components
+
+import (
+	"time"
+
+	"github.com/sammwyy/listnr/internal/timefmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// SeekPrompt asks for a position to jump to, as mm:ss, h:mm:ss or seconds
+type SeekPrompt struct {
+	InputField     *tview.InputField
+	submitCallback func(time.Duration)
+	closeCallback  func()
+}
+
+func NewSeekPrompt() *SeekPrompt {
+	inputField := tview.NewInputField()
+	inputField.SetLabel("Go to: ").
+		SetPlaceholder("mm:ss").
+		SetAcceptanceFunc(func(text string, last rune) bool {
+			return last == ':' || (last >= '0' && last <= '9')
+		}).
+		SetBorder(true).
+		SetBorderColor(tcell.ColorWhite)
+
+	prompt := &SeekPrompt{InputField: inputField}
+	inputField.SetDoneFunc(prompt.done)
+	inputField.SetChangedFunc(func(string) {
+		inputField.SetFieldTextColor(tview.Styles.PrimaryTextColor)
+	})
+	return prompt
+}
+
+// SetSubmitCallback registers a function called with the entered position
+func (sp *SeekPrompt) SetSubmitCallback(callback func(time.Duration)) {
+	sp.submitCallback = callback
+}
+
+// SetCloseCallback registers a function called when the prompt is submitted or cancelled
+func (sp *SeekPrompt) SetCloseCallback(callback func()) {
+	sp.closeCallback = callback
+}
+
+// Reset clears the prompt before it is shown again
+func (sp *SeekPrompt) Reset() {
+	sp.InputField.SetText("")
+}
+
+func (sp *SeekPrompt) done(key tcell.Key) {
+	if key == tcell.KeyEnter {
+		position, ok := timefmt.ParsePosition(sp.InputField.GetText())
+		if !ok {
+			// Keep the prompt open so the typo can be fixed
+			sp.InputField.SetFieldTextColor(tcell.ColorRed)
+			return
+		}
+		if sp.submitCallback != nil {
+			sp.submitCallback(position)
+		}
+	}
+
+	if sp.closeCallback != nil {
+		sp.closeCallback()
+	}
+}
@@ -12,6 +12,7 @@ import (
 type Sidebar struct {
 	List              *tview.List
 	directories       []*library.Directory
+	items             []*library.Directory
 	selectionCallback func(*library.Directory)
 }
 
@@ -32,12 +33,29 @@ func (s *Sidebar) SetDirectories(directories []*library.Directory) {
 	s.populateList()
 }
 
+// SelectDirectory highlights the directory at path without selecting it
+func (s *Sidebar) SelectDirectory(path string) {
+	for i, dir := range s.items {
+		if dir.Path == path {
+			s.List.SetCurrentItem(i)
+			return
+		}
+	}
+}
+
 func (s *Sidebar) SetSelectionCallback(callback func(*library.Directory)) {
 	s.selectionCallback = callback
 }
 
 func (s *Sidebar) populateList() {
+	// Keep the highlighted directory across repopulations
+	var selected string
+	if current := s.List.GetCurrentItem(); current >= 0 && current < len(s.items) {
+		selected = s.items[current].Path
+	}
+
 	s.List.Clear()
+	s.items = s.items[:0]
 
 	var addDirToList func(*library.Directory, int)
 	addDirToList = func(dir *library.Directory, level int) {
@@ -49,6 +67,7 @@ func (s *Sidebar) populateList() {
 				s.selectionCallback(dir)
 			}
 		})
+		s.items = append(s.items, dir)
 
 		for _, subDir := range dir.Dirs {
 			addDirToList(subDir, level+1)
@@ -58,6 +77,13 @@ func (s *Sidebar) populateList() {
 	for _, dir := range s.directories {
 		addDirToList(dir, 0)
 	}
+
+	for i, dir := range s.items {
+		if dir.Path == selected {
+			s.List.SetCurrentItem(i)
+			break
+		}
+	}
 }
 
 func (s *Sidebar) SetFocused(focused bool) {
@@ -32,6 +32,24 @@ func (sl *SongList) SetDirectory(directory *library.Directory) {
 	sl.populateList()
 }
 
+func (sl *SongList) Directory() *library.Directory {
+	return sl.directory
+}
+
+// Refresh repopulates the list, e.g. after the songs' state changed
+func (sl *SongList) Refresh() {
+	current := sl.List.GetCurrentItem()
+	sl.populateList()
+	sl.SetCurrentItem(current)
+}
+
+// Update shows the rescanned version of the directory, keeping the
+// highlighted song
+func (sl *SongList) Update(directory *library.Directory) {
+	sl.directory = directory
+	sl.Refresh()
+}
+
 func (sl *SongList) SetSelectionCallback(callback func(*library.Song, int)) {
 	sl.selectionCallback = callback
 }
@@ -40,11 +58,19 @@ func (sl *SongList) populateList() {
 	sl.List.Clear()
 
 	if sl.directory == nil {
+		sl.List.SetTitle(" Songs ")
 		return
 	}
 
 	for i, song := range sl.directory.Songs {
-		displayName := "🎵 " + song.Name
+		displayName := "🎵 " + song.DisplayName()
+		if resume := song.Resume(); resume != nil {
+			if resume.Finished() {
+				displayName += " [green]✓[-]"
+			} else {
+				displayName += " [yellow]◐[-]"
+			}
+		}
 		// Capture variables for closure
 		currentSong := song
 		currentIndex := i
@@ -60,6 +86,15 @@ func (sl *SongList) populateList() {
 	sl.List.SetTitle(fmt.Sprintf(" Songs - %s ", sl.directory.Name))
 }
 
+// SelectedSong returns the highlighted song
+func (sl *SongList) SelectedSong() *library.Song {
+	index := sl.List.GetCurrentItem()
+	if sl.directory == nil || index < 0 || index >= len(sl.directory.Songs) {
+		return nil
+	}
+	return sl.directory.Songs[index]
+}
+
 func (sl *SongList) SetCurrentItem(index int) {
 	if index >= 0 && index < sl.List.GetItemCount() {
 		sl.List.SetCurrentItem(index)
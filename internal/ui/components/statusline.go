@@ -0,0 +1,38 @@
+package components
+
+import (
+	"github.com/rivo/tview"
+)
+
+// StatusLine is a single line for short-lived messages such as playback errors
+type StatusLine struct {
+	TextView *tview.TextView
+	serial   int
+}
+
+func NewStatusLine() *StatusLine {
+	textView := tview.NewTextView()
+	textView.SetDynamicColors(true).
+		SetScrollable(false).
+		SetWrap(false)
+	textView.SetDisabled(true)
+
+	return &StatusLine{TextView: textView}
+}
+
+// ShowError displays message in red and returns an id for Clear
+func (s *StatusLine) ShowError(message string) int {
+	s.serial++
+	s.TextView.SetText(" [red]✗[-] " + tview.Escape(message))
+	return s.serial
+}
+
+// Clear removes the message shown as id, unless a newer one replaced it.
+// It reports whether the line is now empty.
+func (s *StatusLine) Clear(id int) bool {
+	if id != s.serial {
+		return false
+	}
+	s.TextView.SetText("")
+	return true
+}
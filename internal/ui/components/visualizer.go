@@ -29,7 +29,7 @@ func NewVisualizer() *Visualizer {
 
 	visualizer := &Visualizer{
 		TextView:  textView,
-		bars:      make([]float64, 16), // 16 frequency bands
+		bars:      make([]float64, 16), // Resized to the analyzer's band count
 		isPlaying: false,
 		amplitude: 0.0,
 	}
@@ -51,13 +51,12 @@ func (v *Visualizer) UpdateAudioData(frequencyBands []float64, amplitude float64
 			}
 		}
 	} else {
-		// Use frequency data
-		bandsToUse := len(frequencyBands)
-		if bandsToUse > len(v.bars) {
-			bandsToUse = len(v.bars)
+		// Follow the analyzer's band count
+		if len(frequencyBands) != len(v.bars) {
+			v.bars = make([]float64, len(frequencyBands))
 		}
 
-		for i := 0; i < bandsToUse; i++ {
+		for i := range frequencyBands {
 			target := frequencyBands[i]
 
 			// Smooth transitions
@@ -88,7 +87,7 @@ func (v *Visualizer) render() {
 func (v *Visualizer) renderCompactBars() string {
 	_, _, width, height := v.TextView.GetInnerRect()
 
-	if width < 16 || height < 2 {
+	if width < len(v.bars) || height < 2 {
 		if v.isPlaying {
 			return "[green]♪ Playing...[-]"
 		} else {
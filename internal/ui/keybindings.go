@@ -23,6 +23,16 @@ func (kh *KeyHandler) Setup() {
 }
 
 func (kh *KeyHandler) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	// Typing goes to the prompt while it is open
+	if kh.app.SeekPromptVisible() {
+		return event
+	}
+	if kh.app.EqualizerVisible() {
+		if handled := kh.handleEqualizerKeys(event); handled == nil {
+			return nil
+		}
+	}
+
 	switch event.Key() {
 	case tcell.KeyLeft:
 		kh.app.FocusLeft()
@@ -33,6 +43,11 @@ func (kh *KeyHandler) handleKey(event *tcell.EventKey) *tcell.EventKey {
 	case tcell.KeyEsc:
 		kh.app.Stop()
 		return nil
+	case tcell.KeyDelete:
+		if kh.app.focus == paneQueue {
+			kh.app.RemoveFromQueue()
+			return nil
+		}
 	case tcell.KeyRune:
 		return kh.handleGlobalKeys(event)
 	}
@@ -51,6 +66,13 @@ func (kh *KeyHandler) handleGlobalKeys(event *tcell.EventKey) *tcell.EventKey {
 	case 'd', 'D':
 		kh.app.player.SeekForward()
 		return nil
+	case 'j', 'J':
+		kh.app.ShowSeekPrompt()
+		return nil
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		// Jump to 0-90% of the song
+		kh.player.SeekFraction(float64(event.Rune()-'0') / 10)
+		return nil
 	// Next/Prev song
 	case 'q', 'Q':
 		kh.app.PreviousSong()
@@ -60,11 +82,14 @@ func (kh *KeyHandler) handleGlobalKeys(event *tcell.EventKey) *tcell.EventKey {
 		return nil
 	// Modes
 	case 'r', 'R':
-		kh.app.ToggleRepeatMode()
+		kh.app.CycleRepeatMode()
 		return nil
 	case 'n', 'N':
 		kh.app.ToggleAutoplay()
 		return nil
+	case 'z', 'Z':
+		kh.app.CycleShuffleMode()
+		return nil
 	// Volume
 	case 'w', 'W':
 		kh.player.VolumeUp()
@@ -72,6 +97,91 @@ func (kh *KeyHandler) handleGlobalKeys(event *tcell.EventKey) *tcell.EventKey {
 	case 's', 'S':
 		kh.player.VolumeDown()
 		return nil
+	case 'm', 'M':
+		kh.player.ToggleMute()
+		return nil
+	// Playback speed
+	case '<', ',':
+		kh.player.RateDown()
+		return nil
+	case '>', '.':
+		kh.player.RateUp()
+		return nil
+	case '=':
+		kh.player.SetRate(1)
+		return nil
+	case 't', 'T':
+		kh.player.ToggleRateMode()
+		return nil
+	// A-B loop
+	case 'l', 'L':
+		kh.player.CycleLoop()
+		return nil
+	// Equalizer
+	case 'g', 'G':
+		kh.app.ToggleEqualizer()
+		return nil
+	// Queue
+	case 'f', 'F':
+		kh.app.EnqueueSelected()
+		return nil
+	case 'v', 'V':
+		kh.app.PlaySelectedNext()
+		return nil
+	}
+
+	if kh.app.focus == paneQueue {
+		return kh.handleQueueKeys(event)
+	}
+
+	return event
+}
+
+func (kh *KeyHandler) handleQueueKeys(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Rune() {
+	case 'x', 'X':
+		kh.app.RemoveFromQueue()
+		return nil
+	case '[':
+		kh.app.MoveInQueue(-1)
+		return nil
+	case ']':
+		kh.app.MoveInQueue(1)
+		return nil
+	case 'c', 'C':
+		kh.app.ClearQueue()
+		return nil
+	}
+
+	return event
+}
+
+func (kh *KeyHandler) handleEqualizerKeys(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyLeft:
+		kh.app.equalizer.SelectBand(-1)
+		return nil
+	case tcell.KeyRight:
+		kh.app.equalizer.SelectBand(1)
+		return nil
+	case tcell.KeyUp:
+		kh.app.equalizer.Adjust(1)
+		return nil
+	case tcell.KeyDown:
+		kh.app.equalizer.Adjust(-1)
+		return nil
+	case tcell.KeyEsc:
+		kh.app.ToggleEqualizer()
+		return nil
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'p', 'P':
+			kh.app.CycleEqualizerPreset()
+			return nil
+		case '0':
+			kh.app.ResetEqualizer()
+			return nil
+		}
 	}
 
 	return event